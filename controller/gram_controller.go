@@ -1,49 +1,72 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"github.com/a-h/gemini"
 	"github.com/a-h/gemini/mux"
 	. "github.com/binaryphile/lilleygram/controller/shortcuts"
 	"github.com/binaryphile/lilleygram/helper"
 	"github.com/binaryphile/lilleygram/middleware"
+	"github.com/binaryphile/lilleygram/model"
 	. "github.com/binaryphile/lilleygram/must"
 	"github.com/binaryphile/lilleygram/opt"
+	. "github.com/binaryphile/lilleygram/shortcuts"
 	"github.com/binaryphile/lilleygram/slice"
 	"github.com/binaryphile/lilleygram/sqlrepo"
 	"log"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"strings"
 	"text/template"
 )
 
 type GramController struct {
 	baseTemplateNames []string
+	fileNames         map[string]string
 	funcs             template.FuncMap
-	listTemplate      *Template
 	handler           *Mux
+	pageSize          uint
 	repo              sqlrepo.GramRepo
+	templates         map[string]*Template
+	userRepo          sqlrepo.UserRepo
 }
 
-func NewGramController(repo sqlrepo.GramRepo) GramController {
+func NewGramController(repo sqlrepo.GramRepo, userRepo sqlrepo.UserRepo, pageSize uint) GramController {
 	c := GramController{
 		baseTemplateNames: []string{
 			"view/layout/base.tmpl",
 			"view/partial/nav.tmpl",
 			"view/partial/footer.tmpl",
+			"view/partial/gram.tmpl",
+			"view/partial/pager.tmpl",
+			"view/partial/sparkle.tmpl",
 		},
 		funcs: template.FuncMap{
 			"incr": func(index int) int {
 				return index + 1
 			},
 		},
-		repo: repo,
+		fileNames: map[string]string{
+			"discover": "view/discover.tmpl",
+			"editList": "view/gram.edit.list.tmpl",
+			"get":      "view/gram.get.tmpl",
+			"list":     "view/timeline.tmpl",
+			"search":   "view/search.tmpl",
+			"tag":      "view/tag.tmpl",
+			"tagList":  "view/tag.list.tmpl",
+			"thread":   "view/gram.thread.tmpl",
+		},
+		pageSize:  pageSize,
+		repo:      repo,
+		templates: make(map[string]*Template),
+		userRepo:  userRepo,
 	}
 
-	fileName := "view/timeline.tmpl"
-
-	templates := append([]string{fileName}, c.baseTemplateNames...)
-
-	c.listTemplate = Must(template.New(filepath.Base(fileName)).Funcs(c.funcs).ParseFiles(templates...))
+	for method, fileName := range c.fileNames {
+		c.templates[method] = c.parse(fileName)
+	}
 
 	return c
 }
@@ -54,15 +77,23 @@ func (c GramController) Add(writer ResponseWriter, request *Request) {
 	defer writeError(writer, err)
 
 	if request.URL.RawQuery == "" {
-		err = helper.InputPrompt(writer, "Compose your gram of up to 500 characters:")
+		err = helper.InputPrompt(writer, helper.GramPrompt())
 		return
 	}
 
 	user, _ := middleware.CertUserFromRequest(request)
 
-	gram, err := url.QueryUnescape(request.URL.RawQuery)
+	gram, ok := gramFromQuery(writer, request, helper.GramPrompt())
+	if !ok {
+		return
+	}
 
-	_, err = c.repo.Add(user.UserID, gram)
+	mentionIDs, err := c.mentionIDs(gram)
+	if err != nil {
+		return
+	}
+
+	_, err = c.repo.Add(user.UserID, gram, mentionIDs, helper.TagNames(gram))
 	if err != nil {
 		return
 	}
@@ -70,14 +101,60 @@ func (c GramController) Add(writer ResponseWriter, request *Request) {
 	err = helper.Redirect(writer, "/")
 }
 
-func (c GramController) List(writer ResponseWriter, request *Request) {
+func (c GramController) Delete(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, "Delete this gram for good? (y/n)")
+		return
+	}
+
+	answer, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		return
+	}
+
+	if !helper.IsYes(answer) {
+		err = helper.Redirect(writer, fmt.Sprintf("/grams/%d", gramID))
+		return
+	}
+
+	err = c.repo.Delete(gramID)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, "/")
+}
+
+func (c GramController) Discover(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
 	user, _ := middleware.CertUserFromRequest(request)
 
-	grams, err := c.repo.List(user.UserID)
+	page, ok := pageFromRequest(request, c.pageSize)
+	if !ok {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	grams, more, err := c.repo.Discover(user.UserID, page)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, grams, request.URL.RequestURI())
 	if err != nil {
 		return
 	}
@@ -85,20 +162,179 @@ func (c GramController) List(writer ResponseWriter, request *Request) {
 	data := struct {
 		helper.User
 		Grams []helper.Gram
+		Pager helper.Pager
 	}{
 		User:  user,
-		Grams: slice.Map(helper.GramFromModel, grams),
+		Grams: views,
+		Pager: newPager("/discover", grams, page, more),
 	}
 
-	if deployEnv, ok := middleware.DeployEnvFromRequest(request); ok && deployEnv == "local" {
-		fileName := "view/timeline.tmpl"
+	err = c.render(writer, request, "discover", data)
+}
 
-		templates := append([]string{fileName}, c.baseTemplateNames...)
+func (c GramController) Edit(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
 
-		c.listTemplate = Must(template.New(filepath.Base(fileName)).Funcs(c.funcs).ParseFiles(templates...))
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, helper.GramEditPrompt())
+		return
+	}
+
+	gram, ok := gramFromQuery(writer, request, helper.GramEditPrompt())
+	if !ok {
+		return
+	}
+
+	mentionIDs, err := c.mentionIDs(gram)
+	if err != nil {
+		return
+	}
+
+	err = c.repo.Edit(gramID, gram, mentionIDs, helper.TagNames(gram))
+	if err != nil {
+		return
 	}
 
-	err = c.listTemplate.Execute(writer, data)
+	err = helper.Redirect(writer, fmt.Sprintf("/grams/%d", gramID))
+}
+
+func (c GramController) EditList(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	gram, found, err := c.repo.Get(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	edits, err := c.repo.EditList(gramID)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, []model.Gram{gram}, request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Edits []helper.GramEdit
+		Gram  helper.Gram
+	}{
+		User:  user,
+		Edits: slice.Map(helper.GramEditFromModel, edits),
+		Gram:  views[0],
+	}
+
+	err = c.render(writer, request, "editList", data)
+}
+
+func (c GramController) Get(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	gram, found, err := c.repo.Get(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	sparklers, err := c.repo.SparklerList(gramID)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, []model.Gram{gram}, request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Gram      helper.Gram
+		Sparklers []helper.Member
+	}{
+		User:      user,
+		Gram:      views[0],
+		Sparklers: slice.Map(helper.MemberFromModel, sparklers),
+	}
+
+	err = c.render(writer, request, "get", data)
+}
+
+func (c GramController) List(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	page, ok := pageFromRequest(request, c.pageSize)
+	if !ok {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	grams, more, err := c.repo.List(user.UserID, page)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, grams, request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Grams []helper.Gram
+		Pager helper.Pager
+	}{
+		User:  user,
+		Grams: views,
+		Pager: newPager("/", grams, page, more),
+	}
+
+	err = c.render(writer, request, "list", data)
 }
 
 func (c GramController) Handler(routes ...map[string]Handler) *Mux {
@@ -106,21 +342,192 @@ func (c GramController) Handler(routes ...map[string]Handler) *Mux {
 
 	router := mux.NewMux()
 
-	for pattern, h := range handlers {
-		router.AddRoute(pattern, h)
+	for _, pattern := range routePatterns(handlers) {
+		router.AddRoute(pattern, handlers[pattern])
 	}
 
 	return router
 }
 
+func (c GramController) Pin(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	err = c.repo.Pin(gramID)
+	if errors.Is(err, sqlrepo.ErrPinLimit) {
+		_, err = writer.Write([]byte(fmt.Sprintf(Heredoc(`
+			You've already pinned as many grams as you can.  Unpin one first.
+			=> /users/%d/profile Back to profile
+		`), user.UserID)))
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c GramController) Reply(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	parent, found, err := c.repo.Get(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	prompt := helper.GramReplyPrompt(parent.UserName)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, prompt)
+		return
+	}
+
+	gram, ok := gramFromQuery(writer, request, prompt)
+	if !ok {
+		return
+	}
+
+	mentionIDs, err := c.mentionIDs(gram)
+	if err != nil {
+		return
+	}
+
+	_, err = c.repo.AddReply(user.UserID, gramID, gram, mentionIDs, helper.TagNames(gram))
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/grams/%d/thread", gramID))
+}
+
 func (c GramController) Routes() map[string]Handler {
+	authorOnly := middleware.OwnerOnly(c.repo.GetUserID)
+
 	return map[string]Handler{
-		"/":                   HandlerFunc(c.List),
-		"/grams/add":          HandlerFunc(c.Add),
-		"/grams/{id}/sparkle": HandlerFunc(c.Sparkle),
+		"/":                     HandlerFunc(c.List),
+		"/discover":             HandlerFunc(c.Discover),
+		"/grams/add":            HandlerFunc(c.Add),
+		"/grams/{id}":           HandlerFunc(c.Get),
+		"/grams/{id}/delete":    authorOnly(HandlerFunc(c.Delete)),
+		"/grams/{id}/edit":      authorOnly(HandlerFunc(c.Edit)),
+		"/grams/{id}/history":   HandlerFunc(c.EditList),
+		"/grams/{id}/pin":       authorOnly(HandlerFunc(c.Pin)),
+		"/grams/{id}/reply":     HandlerFunc(c.Reply),
+		"/grams/{id}/sparkle":   HandlerFunc(c.Sparkle),
+		"/grams/{id}/thread":    HandlerFunc(c.Thread),
+		"/grams/{id}/unpin":     authorOnly(HandlerFunc(c.Unpin)),
+		"/grams/{id}/unsparkle": HandlerFunc(c.Unsparkle),
+		"/search":               HandlerFunc(c.Search),
+		"/search/{page}":        HandlerFunc(c.Search),
+		"/tags":                 HandlerFunc(c.TagList),
+		"/tags/{tag}":           HandlerFunc(c.Tag),
 	}
 }
 
+// Search asks for words to search for and shows the grams matching them.
+// Results are paged by number in the path, as in /search/2?lake%20house,
+// since the query string holds the search itself.
+func (c GramController) Search(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, helper.SearchPrompt())
+		return
+	}
+
+	text, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	// collapse whitespace so that the search can't break out of its heading
+	text = strings.Join(strings.Fields(text), " ")
+
+	if text == "" {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, your search is empty. %s", helper.SearchPrompt()))
+		return
+	}
+
+	pageNumber := uint64(1)
+
+	if _, ok := middleware.StrFromRequest(request, "page"); ok {
+		pageNumber, ok = middleware.Uint64FromRequest(request, "page")
+		if !ok || pageNumber < 1 {
+			gemini.BadRequest(writer, request)
+			return
+		}
+	}
+
+	grams, more, err := c.repo.Search(text, user.UserID, uint(pageNumber-1)*c.pageSize, c.pageSize)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, grams, request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	var next, previous string
+
+	if more {
+		next = fmt.Sprintf("/search/%d?%s", pageNumber+1, url.PathEscape(text))
+	}
+
+	if pageNumber > 1 {
+		previous = fmt.Sprintf("/search/%d?%s", pageNumber-1, url.PathEscape(text))
+	}
+
+	data := struct {
+		helper.User
+		Grams    []helper.Gram
+		Next     string
+		Previous string
+		Search   string
+	}{
+		User:     user,
+		Grams:    views,
+		Next:     next,
+		Previous: previous,
+		Search:   text,
+	}
+
+	err = c.render(writer, request, "search", data)
+}
+
 func (c GramController) ServeGemini(writer ResponseWriter, request *Request) {
 	if c.handler == nil {
 		c.handler = c.Handler()
@@ -143,7 +550,323 @@ func (c GramController) Sparkle(writer ResponseWriter, request *Request) {
 		return
 	}
 
-	_, err = c.repo.Sparkle(gramID, user.UserID)
+	found, err := c.repo.Sparkle(gramID, user.UserID)
+	if err != nil {
+		return
+	}
 
-	err = helper.Redirect(writer, "/")
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	err = helper.Redirect(writer, backPath(request))
+}
+
+func (c GramController) Tag(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	name, ok := middleware.StrFromRequest(request, "tag")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no tag")
+		return
+	}
+
+	tag := helper.TagFromName(strings.ToLower(name), 0)
+
+	page, ok := pageFromRequest(request, c.pageSize)
+	if !ok {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	grams, more, err := c.repo.ListByTag(tag.Tag, user.UserID, page)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, grams, request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Grams []helper.Gram
+		Pager helper.Pager
+		Tag   helper.Tag
+	}{
+		User:  user,
+		Grams: views,
+		Pager: newPager(tag.Path, grams, page, more),
+		Tag:   tag,
+	}
+
+	err = c.render(writer, request, "tag", data)
+}
+
+func (c GramController) TagList(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	counts, err := c.repo.TagCountList()
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Tags []helper.Tag
+	}{
+		User: user,
+		Tags: slice.Map(helper.TagCountFromModel, counts),
+	}
+
+	err = c.render(writer, request, "tagList", data)
+}
+
+func (c GramController) Thread(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	gram, found, err := c.repo.Get(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	ancestors, err := c.repo.AncestorList(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	replies, err := c.repo.ReplyList(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.repo, append(append(ancestors, gram), replies...), request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Ancestors []helper.Gram
+		Gram      helper.Gram
+		Replies   []helper.Gram
+	}{
+		User:      user,
+		Ancestors: views[:len(ancestors)],
+		Gram:      views[len(ancestors)],
+		Replies:   views[len(ancestors)+1:],
+	}
+
+	err = c.render(writer, request, "thread", data)
+}
+
+func (c GramController) Unpin(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	err = c.repo.Unpin(gramID)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c GramController) Unsparkle(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	gramID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no ID")
+		return
+	}
+
+	found, err := c.repo.Unsparkle(gramID, user.UserID)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
+	err = helper.Redirect(writer, backPath(request))
+}
+
+// mentionIDs returns the ids of the users mentioned in a gram body.  Names
+// that don't belong to anyone are left alone, as is a possessive such as
+// @KingDad's when it names no one by itself.
+func (c GramController) mentionIDs(body string) (_ []uint64, err error) {
+	userIDs := make([]uint64, 0)
+
+	for _, name := range helper.MentionNames(body) {
+		user, found, err := c.mentionedUser(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			if i := strings.LastIndex(name, "'"); i > 0 {
+				user, found, err = c.mentionedUser(name[:i])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if found && !slices.Contains(userIDs, user.ID) {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+
+	return userIDs, nil
+}
+
+// mentionedUser returns the user a mention names.  Mentions are
+// case-insensitive, so a name that isn't anyone's exactly is looked up by
+// its skeleton, which @kingdad shares with KingDad.
+func (c GramController) mentionedUser(name string) (_ model.User, found bool, err error) {
+	user, found, err := c.userRepo.GetByUserName(name)
+	if err != nil || found {
+		return user, found, err
+	}
+
+	return c.userRepo.GetByUserNameSkeleton(helper.UserNameSkeleton(name))
+}
+
+func (c GramController) parse(fileName string) *Template {
+	templates := append([]string{fileName}, c.baseTemplateNames...)
+
+	return Must(template.New(filepath.Base(fileName)).Funcs(c.funcs).ParseFiles(templates...))
+}
+
+// render executes the named template, reparsing it first when running locally
+// so that template edits show up without a restart.
+func (c GramController) render(writer ResponseWriter, request *Request, name string, data any) error {
+	tmpl := c.templates[name]
+
+	if deployEnv, ok := middleware.DeployEnvFromRequest(request); ok && deployEnv == "local" {
+		tmpl = c.parse(c.fileNames[name])
+	}
+
+	return tmpl.Execute(writer, data)
+}
+
+// gramFromQuery reads a gram body from the query string.  If the body isn't
+// acceptable, it re-prompts the user with the reason and returns false.
+func gramFromQuery(writer ResponseWriter, request *Request, prompt string) (_ string, ok bool) {
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	gram, err := helper.ValidateGram(query)
+	if err != nil {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, %s. %s", err, prompt))
+		if err != nil {
+			log.Print(err)
+		}
+
+		return
+	}
+
+	return gram, true
+}
+
+// backPath returns the page that a gram action such as sparkling came from,
+// as given in its query, or the home page if there's none.  Only a path on
+// this capsule is returned, so that the query can't redirect elsewhere.
+func backPath(request *Request) string {
+	back, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil || !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.Contains(back, "\\") {
+		return "/"
+	}
+
+	return back
+}
+
+// gramsFromModel makes view grams of model grams, along with the users each
+// one mentions and the tags it carries.  back is the page showing them, which
+// actions such as sparkling return to.
+func gramsFromModel(repo sqlrepo.GramRepo, grams []model.Gram, back string) (_ []helper.Gram, err error) {
+	gramIDs := slice.Map(func(gram model.Gram) uint64 {
+		return gram.ID
+	}, grams)
+
+	mentions, err := repo.MentionList(gramIDs)
+	if err != nil {
+		return
+	}
+
+	mentionsByGram := make(map[uint64][]helper.Mention)
+
+	for _, mention := range mentions {
+		mentionsByGram[mention.GramID] = append(mentionsByGram[mention.GramID], helper.MentionFromModel(mention))
+	}
+
+	tags, err := repo.TagList(gramIDs)
+	if err != nil {
+		return
+	}
+
+	tagsByGram := make(map[uint64][]helper.Tag)
+
+	for _, tag := range tags {
+		tagsByGram[tag.GramID] = append(tagsByGram[tag.GramID], helper.TagFromModel(tag))
+	}
+
+	views := make([]helper.Gram, len(grams))
+
+	for i, gram := range grams {
+		views[i] = helper.GramFromModel(gram)
+		views[i].Back = url.PathEscape(back)
+		views[i].Mentions = mentionsByGram[gram.ID]
+		views[i].Tags = tagsByGram[gram.ID]
+	}
+
+	return views, nil
 }
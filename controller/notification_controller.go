@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/mux"
+	. "github.com/binaryphile/lilleygram/controller/shortcuts"
+	"github.com/binaryphile/lilleygram/helper"
+	"github.com/binaryphile/lilleygram/middleware"
+	. "github.com/binaryphile/lilleygram/must"
+	"github.com/binaryphile/lilleygram/opt"
+	"github.com/binaryphile/lilleygram/slice"
+	"github.com/binaryphile/lilleygram/sqlrepo"
+	"log"
+	"path/filepath"
+	"text/template"
+)
+
+type NotificationController struct {
+	baseTemplateNames []string
+	handler           *Mux
+	listTemplate      *Template
+	pageSize          uint
+	repo              sqlrepo.NotificationRepo
+}
+
+func NewNotificationController(repo sqlrepo.NotificationRepo, pageSize uint) NotificationController {
+	c := NotificationController{
+		baseTemplateNames: []string{
+			"view/layout/base.tmpl",
+			"view/partial/nav.tmpl",
+			"view/partial/footer.tmpl",
+			"view/partial/pager.tmpl",
+		},
+		pageSize: pageSize,
+		repo:     repo,
+	}
+
+	fileName := "view/notification.list.tmpl"
+
+	templates := append([]string{fileName}, c.baseTemplateNames...)
+
+	c.listTemplate = Must(template.New(filepath.Base(fileName)).ParseFiles(templates...))
+
+	return c
+}
+
+func (c NotificationController) Handler(routes ...map[string]Handler) *Mux {
+	handlers := opt.OfFirst(routes).Or(c.Routes())
+
+	router := mux.NewMux()
+
+	for _, pattern := range routePatterns(handlers) {
+		router.AddRoute(pattern, handlers[pattern])
+	}
+
+	return router
+}
+
+// List shows the user's notifications, then marks the ones shown as read.
+func (c NotificationController) List(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	page, ok := pageFromRequest(request, c.pageSize)
+	if !ok {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	notifications, more, err := c.repo.List(user.UserID, page)
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Notifications []helper.Notification
+		Pager         helper.Pager
+	}{
+		User:          user,
+		Notifications: slice.Map(helper.NotificationFromModel, notifications),
+		Pager:         newPager("/notifications", notifications, page, more),
+	}
+
+	err = c.listTemplate.Execute(writer, data)
+	if err != nil {
+		return
+	}
+
+	ids := make([]uint64, len(notifications))
+
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+	}
+
+	// the page is already written, so a failure here can only be logged
+	if err := c.repo.MarkRead(user.UserID, ids); err != nil {
+		log.Print(err)
+	}
+}
+
+func (c NotificationController) Routes() map[string]Handler {
+	return map[string]Handler{
+		"/notifications": HandlerFunc(c.List),
+	}
+}
+
+func (c NotificationController) ServeGemini(writer ResponseWriter, request *Request) {
+	if c.handler == nil {
+		c.handler = c.Handler()
+	}
+
+	c.handler.ServeGemini(writer, request)
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	. "github.com/binaryphile/lilleygram/controller/shortcuts"
+	"github.com/binaryphile/lilleygram/helper"
+	"github.com/binaryphile/lilleygram/model"
+	"github.com/binaryphile/lilleygram/sqlrepo"
+)
+
+type cursorer interface {
+	Cursor() model.Cursor
+}
+
+// newPager makes the links to the pages on either side of rows.
+func newPager[T cursorer](path string, rows []T, page sqlrepo.Page, more bool) helper.Pager {
+	pager := helper.Pager{
+		Path: path,
+	}
+
+	// an empty page reached from a stale cursor still links back the way it
+	// came, toward the rows on the other side of the cursor
+	if len(rows) == 0 {
+		switch {
+		case page.Cursor.IsZero():
+		case page.Newer:
+			pager.Older = page.Cursor.String()
+		default:
+			pager.Newer = page.Cursor.String()
+		}
+
+		return pager
+	}
+
+	// a page reached by going older always has newer rows before it, and
+	// vice versa
+	hasNewer, hasOlder := !page.Cursor.IsZero(), more
+
+	if page.Newer {
+		hasNewer, hasOlder = more, true
+	}
+
+	if hasNewer {
+		pager.Newer = rows[0].Cursor().String()
+	}
+
+	if hasOlder {
+		pager.Older = rows[len(rows)-1].Cursor().String()
+	}
+
+	return pager
+}
+
+// pageFromRequest reads the page position from the before or after cursor in
+// the query string.
+func pageFromRequest(request *Request, limit uint) (_ sqlrepo.Page, ok bool) {
+	page := sqlrepo.Page{
+		Limit: limit,
+	}
+
+	query := request.URL.Query()
+
+	if after := query.Get("after"); after != "" {
+		page.Cursor, ok = model.ParseCursor(after)
+		page.Newer = true
+
+		return page, ok
+	}
+
+	if before := query.Get("before"); before != "" {
+		page.Cursor, ok = model.ParseCursor(before)
+
+		return page, ok
+	}
+
+	return page, true
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"github.com/binaryphile/lilleygram/helper"
+	"github.com/binaryphile/lilleygram/model"
+	"github.com/binaryphile/lilleygram/sqlrepo"
+	"testing"
+)
+
+func TestNewPager(t *testing.T) {
+	cursor := model.Cursor{CreatedAt: 100, ID: 5}
+
+	grams := []model.Gram{
+		{ID: 9, CreatedAt: 300},
+		{ID: 8, CreatedAt: 200},
+	}
+
+	tests := []struct {
+		name string
+		rows []model.Gram
+		page sqlrepo.Page
+		more bool
+		want helper.Pager
+	}{
+		{
+			name: "first page",
+			rows: grams,
+			more: true,
+			want: helper.Pager{Path: "/", Older: "200-8"},
+		},
+		{
+			name: "only page",
+			rows: grams,
+			want: helper.Pager{Path: "/"},
+		},
+		{
+			name: "older page",
+			rows: grams,
+			page: sqlrepo.Page{Cursor: cursor},
+			want: helper.Pager{Path: "/", Newer: "300-9"},
+		},
+		{
+			name: "newer page",
+			rows: grams,
+			page: sqlrepo.Page{Cursor: cursor, Newer: true},
+			want: helper.Pager{Path: "/", Older: "200-8"},
+		},
+		{
+			name: "empty",
+			want: helper.Pager{Path: "/"},
+		},
+		{
+			name: "empty older page",
+			page: sqlrepo.Page{Cursor: cursor},
+			want: helper.Pager{Path: "/", Newer: "100-5"},
+		},
+		{
+			name: "empty newer page",
+			page: sqlrepo.Page{Cursor: cursor, Newer: true},
+			want: helper.Pager{Path: "/", Older: "100-5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPager("/", tt.rows, tt.page, tt.more); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	. "github.com/binaryphile/lilleygram/controller/shortcuts"
+	"sort"
+	"strings"
+)
+
+// routePatterns orders the patterns so that the mux, which takes the first
+// match, tries literal routes such as /grams/add before variable ones such
+// as /grams/{id}.
+func routePatterns(handlers map[string]Handler) []string {
+	patterns := make([]string, 0, len(handlers))
+
+	for pattern := range handlers {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		iVars, jVars := strings.Count(patterns[i], "{"), strings.Count(patterns[j], "{")
+
+		if iVars != jVars {
+			return iVars < jVars
+		}
+
+		return patterns[i] < patterns[j]
+	})
+
+	return patterns
+}
@@ -12,11 +12,17 @@ import (
 	"github.com/binaryphile/lilleygram/hash"
 	"github.com/binaryphile/lilleygram/helper"
 	"github.com/binaryphile/lilleygram/middleware"
+	"github.com/binaryphile/lilleygram/model"
 	"github.com/binaryphile/lilleygram/opt"
 	. "github.com/binaryphile/lilleygram/shortcuts"
 	"github.com/binaryphile/lilleygram/sqlrepo"
+	"golang.org/x/text/unicode/norm"
 	"log"
 	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type (
@@ -34,82 +40,128 @@ func NewUnauthenticatedController(repo sqlrepo.UserRepo) UnauthenticatedControll
 	return c
 }
 
+// CertificateAdd adds the request's certificate to an account when given the
+// account's password.  A wrong password and a username that doesn't exist get
+// the same response, and each failure makes the client wait longer before it
+// can try again.
 func (c UnauthenticatedController) CertificateAdd(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
-	if request.URL.RawQuery == "" {
-		err = helper.InputSensitive(writer, "Password:")
+	certID := request.Certificate.ID
+
+	if certID == "" {
+		_, err = writer.Write([]byte(Heredoc(`
+			Error: no certificate supplied.  Please enable your certificate and try again.
+			=> . Try Again
+		`)))
 		return
 	}
 
-	rawPassword := request.URL.RawQuery
-
-	userID, ok := middleware.Uint64FromRequest(request, "userID")
+	userName, ok := middleware.StrFromRequest(request, "userName")
 	if !ok {
 		gemini.BadRequest(writer, request)
-		log.Print("no user id")
+		log.Print("no username")
+		return
+	}
+
+	idHash := sha256.Sum256([]byte(certID))
+
+	certSHA256 := hex.EncodeToString(idHash[:])
+
+	skeleton := helper.UserNameSkeleton(userName)
+
+	if request.URL.RawQuery == "" {
+		var wait int64
+
+		wait, err = c.repo.LoginBackoff(certSHA256, skeleton)
+		if err != nil {
+			helper.InternalServerError(writer, err)
+			return
+		}
+
+		if wait > 0 {
+			err = writer.SetHeader(gemini.CodeSlowDown, strconv.FormatInt(wait, 10))
+			return
+		}
+
+		err = helper.InputSensitive(writer, "Password:")
 		return
 	}
 
-	password, found, err := c.repo.PasswordGet(userID)
+	rawPassword := request.URL.RawQuery
+
+	user, found, err := c.repo.GetByUserName(userName)
 	if err != nil {
 		helper.InternalServerError(writer, err)
 		return
 	}
 
-	salt, err := base64.RawStdEncoding.DecodeString(password.Salt)
+	// the attempt is recorded before the password is checked, so that
+	// attempts made at the same time can't all get past the backoff
+	attemptID, wait, err := c.repo.LoginAttemptAdd(certSHA256, user.ID, skeleton)
 	if err != nil {
 		helper.InternalServerError(writer, err)
+		return
 	}
 
-	if hash.ComparePasswords(rawPassword, salt, password.Argon2) && found {
-		certID := request.Certificate.ID
-
-		if certID == "" {
-			_, err := writer.Write([]byte(Heredoc(`
-				Error: no certificate supplied.  Please enable your certificate and try again.
-				=> . Try Again
-			`)))
-			if err != nil {
-				helper.InternalServerError(writer, err)
-				return
-			}
+	if wait > 0 {
+		err = writer.SetHeader(gemini.CodeSlowDown, strconv.FormatInt(wait, 10))
+		return
+	}
 
-			return
-		}
+	password := standInPassword()
 
-		idHash := sha256.Sum256([]byte(certID))
+	passwordFound := false
 
-		certSHA256 := hex.EncodeToString(idHash[:])
+	if found {
+		var p model.Password
 
-		err = c.repo.CertificateAdd(certSHA256, 0, uint64(userID))
+		p, passwordFound, err = c.repo.PasswordGet(user.ID)
 		if err != nil {
 			helper.InternalServerError(writer, err)
 			return
 		}
 
+		if passwordFound {
+			password = p
+		}
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(password.Salt)
+	if err != nil {
+		helper.InternalServerError(writer, err)
+		return
+	}
+
+	// the password is compared even when there's no account or password to
+	// compare it to, so that the response takes as long either way.  A wrong
+	// password leaves the attempt recorded as a failure.
+	if !hash.ComparePasswords(rawPassword, salt, password.Argon2) || !passwordFound {
 		_, err = writer.Write([]byte(Heredoc(`
-			Certificate added successfully.
-			=> / Return home
+			Either the username or password were incorrect.
+			=> /register/username/check Try again
 		`)))
-		if err != nil {
-			helper.InternalServerError(writer, err)
-			return
-		}
+		return
+	}
 
+	err = c.repo.LoginAttemptDelete(attemptID)
+	if err != nil {
+		helper.InternalServerError(writer, err)
 		return
 	}
 
-	_, err = writer.Write([]byte(Heredoc(`
-		Either the username or password were incorrect.
-		=> /register/username/check Try again
-	`)))
+	err = c.repo.CertificateAdd(certSHA256, helper.CertificateExpireAt(request.Certificate.Key), user.ID)
 	if err != nil {
 		helper.InternalServerError(writer, err)
 		return
 	}
+
+	_, err = writer.Write([]byte(Heredoc(`
+		Certificate added successfully.
+		=> / Return home
+	`)))
 }
 
 func (c UnauthenticatedController) CodeCheck(writer ResponseWriter, request *Request) {
@@ -165,7 +217,7 @@ func (c UnauthenticatedController) CodeCheck(writer ResponseWriter, request *Req
 				return err
 			}
 
-			return tx.CertificateAdd(certSHA256, 0, userID)
+			return tx.CertificateAdd(certSHA256, helper.CertificateExpireAt(request.Certificate.Key), userID)
 		},
 	)
 	if err != nil {
@@ -180,13 +232,93 @@ func (c UnauthenticatedController) Handler(routes ...map[string]Handler) *Mux {
 
 	router := mux.NewMux()
 
-	for pattern, h := range handlers {
-		router.AddRoute(pattern, h)
+	for _, pattern := range routePatterns(handlers) {
+		router.AddRoute(pattern, handlers[pattern])
 	}
 
 	return router
 }
 
+// PairingCodeCheck adds the request's certificate to the account of the user
+// who made the pairing code entered.
+func (c UnauthenticatedController) PairingCodeCheck(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	certID := request.Certificate.ID
+
+	if certID == "" {
+		err = writer.SetHeader(gemini.CodeClientCertificateRequired, "Enable a certificate for this site, then try again")
+		return
+	}
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputSensitive(writer, "Pairing code from your signed-in device:")
+		return
+	}
+
+	code, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	idHash := sha256.Sum256([]byte(certID))
+
+	certSHA256 := hex.EncodeToString(idHash[:])
+
+	keySHA256 := helper.CertificateKeySHA256(request.Certificate.Key)
+
+	// a certificate can only belong to one account, so one that's registered
+	// already is turned away before the code is used up
+	registered, err := c.repo.CertificateRegistered(certSHA256, keySHA256)
+	if err != nil {
+		helper.InternalServerError(writer, err)
+		return
+	}
+
+	if registered {
+		_, err = writer.Write([]byte(Heredoc(`
+			This certificate is already registered to an account, so it can't be added to another.  Enable a new certificate for this site on this device, then try again.
+			=> / Go home
+		`)))
+		return
+	}
+
+	var found bool
+
+	err = c.repo.WithTx(
+		func(tx sqlrepo.UserRepo) error {
+			userID, ok, err := tx.PairingCodeUse(helper.PairingCodeSHA256(code))
+			if err != nil || !ok {
+				return err
+			}
+
+			found = true
+
+			return tx.CertificateAdd(certSHA256, helper.CertificateExpireAt(request.Certificate.Key), userID)
+		},
+	)
+	if err != nil {
+		helper.InternalServerError(writer, err)
+		return
+	}
+
+	if !found {
+		_, err = writer.Write([]byte(Heredoc(`
+			That code is wrong or has expired.  Make a new one from your profile on a signed-in device.
+			=> /register/pairing/check Try again
+		`)))
+		return
+	}
+
+	_, err = writer.Write([]byte(Heredoc(`
+		This device has been added to your account.
+		=> / Go home
+	`)))
+}
+
 func (c UnauthenticatedController) Routes() map[string]Handler {
 	baseTemplates := []string{
 		"view/unauthenticated/partial/nav.tmpl",
@@ -199,12 +331,13 @@ func (c UnauthenticatedController) Routes() map[string]Handler {
 	registerTemplates := append([]string{"view/unauthenticated/register.tmpl"}, baseTemplates...)
 
 	return map[string]Handler{
-		"/":                                  handler.FileHandler(homeTemplates...),
-		"/getting-started":                   handler.FileHandler(gettingStartedTemplates...),
-		"/register":                          handler.FileHandler(registerTemplates...),
-		"/register/code/check":               HandlerFunc(c.CodeCheck),
-		"/register/username/check":           HandlerFunc(c.UserNameCheck),
-		"/register/{userID}/certificate/add": HandlerFunc(c.CertificateAdd),
+		"/":                                    handler.FileHandler(homeTemplates...),
+		"/getting-started":                     handler.FileHandler(gettingStartedTemplates...),
+		"/register":                            handler.FileHandler(registerTemplates...),
+		"/register/code/check":                 HandlerFunc(c.CodeCheck),
+		"/register/pairing/check":              HandlerFunc(c.PairingCodeCheck),
+		"/register/username/check":             HandlerFunc(c.UserNameCheck),
+		"/register/{userName}/certificate/add": HandlerFunc(c.CertificateAdd),
 	}
 }
 
@@ -216,6 +349,9 @@ func (c UnauthenticatedController) ServeGemini(writer ResponseWriter, request *R
 	c.handler.ServeGemini(writer, request)
 }
 
+// UserNameCheck asks for the username of the account to add a certificate to.
+// It doesn't look the username up, so that it can't be used to find out who
+// has an account.
 func (c UnauthenticatedController) UserNameCheck(writer ResponseWriter, request *Request) {
 	var err error
 
@@ -226,24 +362,15 @@ func (c UnauthenticatedController) UserNameCheck(writer ResponseWriter, request
 		return
 	}
 
-	userName := request.URL.RawQuery
-
-	user, found, err := c.repo.GetByUserName(userName)
+	query, err := url.PathUnescape(request.URL.RawQuery)
 	if err != nil {
+		gemini.BadRequest(writer, request)
 		return
 	}
 
-	if !found {
-		_, err = writer.Write([]byte(Heredoc(`
-			That user was not found.  If you feel this result was in error, click the link below to try again.
-			=> /register/username/check Try again
-		`)))
-		if err != nil {
-			return
-		}
-	}
+	userName := norm.NFC.String(strings.TrimSpace(query))
 
-	err = helper.Redirect(writer, fmt.Sprintf("/register/%d/certificate/add", user.ID))
+	err = helper.Redirect(writer, fmt.Sprintf("/register/%s/certificate/add", url.PathEscape(userName)))
 }
 
 func writeError(writer ResponseWriter, err error) {
@@ -251,3 +378,14 @@ func writeError(writer ResponseWriter, err error) {
 		helper.InternalServerError(writer, err)
 	}
 }
+
+// standInPassword is compared against when an account has no password, or
+// there's no account, so that those attempts take as long as any other.
+var standInPassword = sync.OnceValue(func() model.Password {
+	salt := hash.GenerateSalt()
+
+	return model.Password{
+		Argon2: hash.HashPassword(string(salt), salt),
+		Salt:   base64.RawStdEncoding.EncodeToString(salt),
+	}
+})
@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/mux"
+	. "github.com/binaryphile/lilleygram/controller/shortcuts"
+	"github.com/binaryphile/lilleygram/helper"
+	"github.com/binaryphile/lilleygram/model"
+	"github.com/binaryphile/lilleygram/sqlrepo"
+	"github.com/doug-martin/goqu/v9"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestCertificateAddBackoff(t *testing.T) {
+	repo := newTestUserRepo(t, func() int64 { return time.Now().Unix() })
+
+	// passwords are set and checked as the query the client sends
+	password, _, _, _, _, _ := model.NewPassword(url.PathEscape("Secret12!x"))
+
+	if err := repo.PasswordSet(2, password); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewUnauthenticatedController(repo)
+
+	request := func(certID, userName, password string) *testResponseWriter {
+		writer := &testResponseWriter{}
+
+		// the route alone is mounted, since the others load templates
+		router := mux.NewMux()
+		router.AddRoute("/register/{userName}/certificate/add", HandlerFunc(c.CertificateAdd))
+
+		router.ServeGemini(writer, &gemini.Request{
+			Context:     context.Background(),
+			URL:         &url.URL{Path: "/register/" + userName + "/certificate/add", RawQuery: url.PathEscape(password)},
+			Certificate: gemini.Certificate{ID: certID},
+		})
+
+		return writer
+	}
+
+	t.Run("burst of wrong passwords", func(t *testing.T) {
+		const attempts = 10
+
+		responses := make(chan *testResponseWriter, attempts)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				responses <- request(fmt.Sprintf("burst %d", i), "Grandma", "wrong")
+			}(i)
+		}
+
+		wg.Wait()
+		close(responses)
+
+		compared := 0
+
+		for writer := range responses {
+			if strings.Contains(writer.body.String(), "incorrect") {
+				compared++
+			}
+		}
+
+		if compared > 3 {
+			t.Errorf("%d of %d attempts at once had their password checked, want at most 3", compared, attempts)
+		}
+
+		if writer := request("burst", "Grandma", "Secret12!x"); writer.code != gemini.CodeSlowDown {
+			t.Errorf("right password after the burst: got code %q, want %q", writer.code, gemini.CodeSlowDown)
+		}
+	})
+
+	t.Run("unknown username", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if writer := request("unknown", "Nobody", "wrong"); !strings.Contains(writer.body.String(), "incorrect") {
+				t.Fatalf("attempt %d: got %q %q, want the incorrect password page", i+1, writer.code, writer.body.String())
+			}
+		}
+
+		if writer := request("unknown", "Nobody", "wrong"); writer.code != gemini.CodeSlowDown {
+			t.Errorf("fourth attempt: got code %q, want %q", writer.code, gemini.CodeSlowDown)
+		}
+	})
+
+	t.Run("right password", func(t *testing.T) {
+		repo := newTestUserRepo(t, func() int64 { return time.Now().Unix() })
+
+		if err := repo.PasswordSet(2, password); err != nil {
+			t.Fatal(err)
+		}
+
+		c = NewUnauthenticatedController(repo)
+
+		if writer := request("right", "Grandma", "Secret12!x"); !strings.Contains(writer.body.String(), "added successfully") {
+			t.Fatalf("got %q %q, want the certificate added", writer.code, writer.body.String())
+		}
+
+		failures, err := repo.LoginFailureList(2, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(failures) != 0 {
+			t.Errorf("got %d failures recorded for a right password, want 0", len(failures))
+		}
+	})
+
+	t.Run("right password from a registered certificate", func(t *testing.T) {
+		repo := newTestUserRepo(t, func() int64 { return time.Now().Unix() })
+
+		if err := repo.PasswordSet(2, password); err != nil {
+			t.Fatal(err)
+		}
+
+		addCertificate(t, repo, "registered", "", 2)
+
+		c = NewUnauthenticatedController(repo)
+
+		if writer := request("registered", "Grandma", "Secret12!x"); writer.code != gemini.CodePermanentFailure {
+			t.Errorf("got %q %q, want code %q", writer.code, writer.body.String(), gemini.CodePermanentFailure)
+		}
+	})
+}
+
+func TestPairingCodeCheck(t *testing.T) {
+	type step struct {
+		certID   string
+		key      string
+		code     string
+		want     string
+		wantUser uint64
+	}
+
+	otherKey := testCertificate(t, nil)
+
+	tests := []struct {
+		name  string
+		steps []step
+		after time.Duration
+	}{
+		{
+			name: "new certificate",
+			steps: []step{
+				{certID: "new", code: "code", want: "added to your account", wantUser: 1},
+			},
+		},
+		{
+			name: "code typed loosely",
+			steps: []step{
+				{certID: "new", code: "co de", want: "added to your account", wantUser: 1},
+			},
+		},
+		{
+			name: "wrong code",
+			steps: []step{
+				{certID: "new", code: "wrong", want: "wrong or has expired"},
+			},
+		},
+		{
+			name:  "expired code",
+			after: helper.PairingCodeLifetime + time.Second,
+			steps: []step{
+				{certID: "new", code: "code", want: "wrong or has expired"},
+			},
+		},
+		{
+			name: "reused code",
+			steps: []step{
+				{certID: "new", code: "code", want: "added to your account", wantUser: 1},
+				{certID: "newer", code: "code", want: "wrong or has expired"},
+			},
+		},
+		{
+			name: "certificate of this account",
+			steps: []step{
+				{certID: "own", code: "code", want: "already registered", wantUser: 1},
+				{certID: "new", code: "code", want: "added to your account", wantUser: 1},
+			},
+		},
+		{
+			name: "certificate of another account",
+			steps: []step{
+				{certID: "grandma", code: "code", want: "already registered", wantUser: 2},
+				{certID: "new", code: "code", want: "added to your account", wantUser: 1},
+			},
+		},
+		{
+			name: "key of another account's certificate",
+			steps: []step{
+				{certID: "renewed", key: otherKey, code: "code", want: "already registered"},
+				{certID: "new", code: "code", want: "added to your account", wantUser: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+
+			repo := newTestUserRepo(t, func() int64 { return now.Unix() })
+
+			addCertificate(t, repo, "own", "", 1)
+			addCertificate(t, repo, "grandma", otherKey, 2)
+
+			if err := repo.PairingCodeAdd(1, helper.PairingCodeSHA256("CODE"), helper.PairingCodeLifetime); err != nil {
+				t.Fatal(err)
+			}
+
+			now = now.Add(tt.after)
+
+			c := NewUnauthenticatedController(repo)
+
+			for _, s := range tt.steps {
+				writer := &testResponseWriter{}
+
+				request := &gemini.Request{
+					URL: &url.URL{Path: "/register/pairing/check", RawQuery: url.PathEscape(s.code)},
+					Certificate: gemini.Certificate{
+						ID:  s.certID,
+						Key: s.key,
+					},
+				}
+
+				c.PairingCodeCheck(writer, request)
+
+				if writer.code != "" {
+					t.Fatalf("cert %q: got header %s %s, want a page", s.certID, writer.code, writer.meta)
+				}
+
+				if !strings.Contains(writer.body.String(), s.want) {
+					t.Errorf("cert %q: got %q, want it to contain %q", s.certID, writer.body.String(), s.want)
+				}
+
+				user, found, err := repo.GetByCertificate(certSHA256(s.certID))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if found && user.ID != s.wantUser || !found && s.wantUser != 0 {
+					t.Errorf("cert %q: registered to user %d (found %v), want user %d", s.certID, user.ID, found, s.wantUser)
+				}
+			}
+		})
+	}
+}
+
+func TestPairingCodeCheckWithoutCertificate(t *testing.T) {
+	repo := newTestUserRepo(t, func() int64 { return time.Now().Unix() })
+
+	writer := &testResponseWriter{}
+
+	request := &gemini.Request{
+		URL: &url.URL{Path: "/register/pairing/check", RawQuery: "CODE"},
+	}
+
+	NewUnauthenticatedController(repo).PairingCodeCheck(writer, request)
+
+	if writer.code != gemini.CodeClientCertificateRequired {
+		t.Errorf("got code %q, want %q", writer.code, gemini.CodeClientCertificateRequired)
+	}
+}
+
+type testResponseWriter struct {
+	body bytes.Buffer
+	code gemini.Code
+	meta string
+}
+
+func (w *testResponseWriter) SetHeader(code gemini.Code, meta string) error {
+	w.code, w.meta = code, meta
+
+	return nil
+}
+
+func (w *testResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+// addCertificate registers a certificate to a user.  If key isn't "", renewal
+// by key is turned on and the key is recorded, as when the certificate signs
+// in.
+func addCertificate(t *testing.T, repo sqlrepo.UserRepo, certID, key string, userID uint64) {
+	t.Helper()
+
+	sha256 := certSHA256(certID)
+
+	if err := repo.CertificateAdd(sha256, 0, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if key == "" {
+		return
+	}
+
+	if err := repo.CertificateRenewByKey(userID, sha256, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.CertificateBindKey(sha256, helper.CertificateKeySHA256(key)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// certSHA256 returns the hash a certificate id is stored under.
+func certSHA256(certID string) string {
+	hash := sha256.Sum256([]byte(certID))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// newTestUserRepo returns a repo over a new database with every migration
+// applied, which seeds the first user.  A second user is added as well.
+func newTestUserRepo(t *testing.T, now func() int64) sqlrepo.UserRepo {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { sqlDB.Close() })
+
+	files, err := filepath.Glob("../migrations/V*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := regexp.MustCompile(`V(\d+)__`)
+
+	sort.Slice(files, func(i, j int) bool {
+		a, _ := strconv.Atoi(version.FindStringSubmatch(files[i])[1])
+		b, _ := strconv.Atoi(version.FindStringSubmatch(files[j])[1])
+
+		return a < b
+	})
+
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = sqlDB.Exec(string(migration)); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+	}
+
+	repo := sqlrepo.NewUserRepo(goqu.New("sqlite3", sqlDB), now)
+
+	if _, err = repo.Add("Grandma", "Lilley", "Grandma", "🐱"); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+// testCertificate returns a self-signed client certificate in DER form for
+// key, or for a new key if key is nil.
+func testCertificate(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	if key == nil {
+		var err error
+
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(der)
+}
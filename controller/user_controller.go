@@ -2,6 +2,7 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/a-h/gemini"
 	"github.com/a-h/gemini/mux"
@@ -12,11 +13,13 @@ import (
 	. "github.com/binaryphile/lilleygram/must"
 	"github.com/binaryphile/lilleygram/opt"
 	. "github.com/binaryphile/lilleygram/shortcuts"
+	"github.com/binaryphile/lilleygram/slice"
 	"github.com/binaryphile/lilleygram/sqlrepo"
 	"log"
 	"net/url"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
 )
 
@@ -24,31 +27,42 @@ type (
 	UserController struct {
 		baseTemplateNames []string
 		funcs             template.FuncMap
+		gramRepo          sqlrepo.GramRepo
 		handler           *Mux
+		pageSize          uint
 		repo              sqlrepo.UserRepo
 		templates         map[string]*Template
 	}
 )
 
-func NewUserController(repo sqlrepo.UserRepo) UserController {
+func NewUserController(repo sqlrepo.UserRepo, gramRepo sqlrepo.GramRepo, pageSize uint) UserController {
 	c := UserController{
 		baseTemplateNames: []string{
 			"view/layout/base.tmpl",
 			"view/partial/footer.tmpl",
 			"view/partial/nav.tmpl",
+			"view/partial/gram.tmpl",
+			"view/partial/pager.tmpl",
+			"view/partial/sparkle.tmpl",
 		},
 		funcs: template.FuncMap{
 			"incr": func(index int) int {
 				return index + 1
 			},
 		},
+		gramRepo:  gramRepo,
+		pageSize:  pageSize,
 		repo:      repo,
 		templates: make(map[string]*Template),
 	}
 
 	fileNames := map[string]string{
-		"passwordGet": "view/password.get.tmpl",
-		"profileGet":  "view/profile.get.tmpl",
+		"avatarPick":      "view/avatar.pick.tmpl",
+		"certificateList": "view/certificate.list.tmpl",
+		"followList":      "view/follow.list.tmpl",
+		"passwordGet":     "view/password.get.tmpl",
+		"profileGet":      "view/profile.get.tmpl",
+		"userList":        "view/user.list.tmpl",
 	}
 
 	for method, fileName := range fileNames {
@@ -60,6 +74,63 @@ func NewUserController(repo sqlrepo.UserRepo) UserController {
 	return c
 }
 
+// AvatarPick shows the categories of the emoji catalog, or the emoji in one
+// of them when the path names it.  Each emoji links to AvatarSet with the
+// emoji as its input, so that picking it sets the avatar without typing.
+func (c UserController) AvatarPick(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	data := struct {
+		helper.User
+		Categories []helper.EmojiCategory
+		Category   helper.EmojiCategory
+		Choices    []helper.EmojiChoice
+		Next       int
+		Previous   int
+	}{
+		User:       user,
+		Categories: helper.EmojiCatalog,
+	}
+
+	if slug, ok := middleware.StrFromRequest(request, "category"); ok {
+		category, found := helper.EmojiCategoryBySlug(slug)
+		if !found {
+			gemini.NotFound(writer, request)
+			return
+		}
+
+		page := 1
+
+		if query := request.URL.Query().Get("page"); query != "" {
+			page, err = strconv.Atoi(query)
+			if err != nil || page < 1 {
+				gemini.BadRequest(writer, request)
+				return
+			}
+		}
+
+		start := min((page-1)*helper.EmojiPageSize, len(category.Emoji))
+		end := min(start+helper.EmojiPageSize, len(category.Emoji))
+
+		data.Category = category
+		data.Choices = slice.Map(helper.EmojiChoiceFromEmoji, category.Emoji[start:end])
+
+		if end < len(category.Emoji) {
+			data.Next = page + 1
+		}
+
+		if page > 1 {
+			data.Previous = page - 1
+		}
+	}
+
+	err = c.templates["avatarPick"].Execute(writer, data)
+}
+
 func (c UserController) AvatarSet(writer ResponseWriter, request *Request) {
 	var err error
 
@@ -82,10 +153,9 @@ func (c UserController) AvatarSet(writer ResponseWriter, request *Request) {
 		_, err = writer.Write([]byte(Heredoc(`
 			Avatar must be a single character and may be any emoji.
 			=> set Try again
+			=> ../avatar Pick one from a list
 		`)))
-		if err != nil {
-			return
-		}
+		return
 	}
 
 	err = c.repo.UpdateAvatar(u.UserID, avatar)
@@ -96,204 +166,294 @@ func (c UserController) AvatarSet(writer ResponseWriter, request *Request) {
 	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/firstname/set", u.UserID))
 }
 
-func (c UserController) FirstNameSet(writer ResponseWriter, request *Request) {
+func (c UserController) BioSet(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
 	user, _ := middleware.CertUserFromRequest(request)
 
-	strID, _ := middleware.StrFromRequest(request, "userID")
-
-	intID, err := strconv.Atoi(strID)
-	if err != nil {
-		return
-	}
-
-	pathUserID := uint64(intID)
+	prompt := fmt.Sprintf("Tell everyone about yourself in up to %d characters:", helper.BioMaxLength)
 
-	if user.UserID != pathUserID {
-		gemini.NotFound(writer, request)
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, prompt)
 		return
 	}
 
-	if request.URL.RawQuery == "" {
-		err = helper.InputPrompt(writer, "Enter your first name:")
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
 		return
 	}
 
-	firstName, ok := helper.ValidateName(request.URL.RawQuery)
+	bio, ok := helper.ValidateBio(query)
 	if !ok {
-		_, err = writer.Write([]byte(Heredoc(`
-			Name must be between 1 and 25 characters and may include letters, space, apostrophe and hyphen.
-			=> set Try again
-		`)))
-		if err != nil {
-			return
-		}
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, that's too long. %s", prompt))
+		return
 	}
 
-	err = c.repo.UpdateFirstName(pathUserID, firstName)
-	if err != nil { // TODO: userName conflict
+	err = c.repo.UpdateBio(user.UserID, bio)
+	if err != nil {
 		return
 	}
 
-	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/lastname/set", pathUserID))
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
 }
 
-func (c UserController) Handler(routes ...map[string]Handler) *Mux {
-	handlers := opt.OfFirst(routes).Or(c.Routes())
+func (c UserController) CertificateLabel(writer ResponseWriter, request *Request) {
+	var err error
 
-	router := mux.NewMux()
+	defer writeError(writer, err)
 
-	for pattern, h := range handlers {
-		router.AddRoute(pattern, h)
-	}
+	user, _ := middleware.CertUserFromRequest(request)
 
-	return router
-}
+	certSHA256, _ := middleware.StrFromRequest(request, "sha256")
 
-func (c UserController) LastNameSet(writer ResponseWriter, request *Request) {
-	var err error
+	_, found, err := c.repo.CertificateGet(user.UserID, certSHA256)
+	if err != nil {
+		return
+	}
 
-	defer writeError(writer, err)
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
 
-	u, _ := middleware.CertUserFromRequest(request)
+	prompt := "Name this certificate for the device it's on, such as Laptop or Phone:"
 
 	if request.URL.RawQuery == "" {
-		err = helper.InputPrompt(writer, "Enter your last name:")
+		err = helper.InputPrompt(writer, prompt)
 		return
 	}
 
-	lastName, ok := helper.ValidateName(request.URL.RawQuery)
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	label, ok := helper.ValidateCertificateLabel(query)
 	if !ok {
-		_, err = writer.Write([]byte(Heredoc(`
-			Name must be between 1 and 25 characters and may include letters, space, apostrophe and hyphen.
-			=> set Try again
-		`)))
-		if err != nil {
-			return
-		}
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, that must be between 1 and 30 characters. %s", prompt))
+		return
 	}
 
-	err = c.repo.UpdateLastName(u.UserID, lastName)
-	if err != nil { // TODO: userName conflict
+	err = c.repo.CertificateLabel(user.UserID, certSHA256, label)
+	if err != nil {
 		return
 	}
 
-	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", u.UserID))
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/certificates", user.UserID))
 }
 
-func (c UserController) PasswordGet(writer ResponseWriter, request *Request) {
+// CertificateList shows the certificates that can sign in to the user's
+// account, so that they can be labeled and revoked, along with recent failed
+// attempts to add one with the account's password.
+func (c UserController) CertificateList(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
 	user, _ := middleware.CertUserFromRequest(request)
 
-	password, _, err := c.repo.PasswordGet(user.UserID)
+	cs, err := c.repo.CertificateListByUser(user.UserID)
+	if err != nil {
+		return
+	}
+
+	certificates := make([]helper.Certificate, len(cs))
+
+	for i, certificate := range cs {
+		certificates[i] = helper.CertificateFromModel(certificate)
+		certificates[i].Current = certificate.SHA256 == user.CertSHA256
+	}
+
+	fs, err := c.repo.LoginFailureList(user.UserID, helper.LoginFailuresShown)
 	if err != nil {
 		return
 	}
 
+	failures := make([]helper.LoginFailure, len(fs))
+
+	for i, failure := range fs {
+		failures[i] = helper.LoginFailureFromModel(failure)
+	}
+
 	data := struct {
-		Password model.Password
-		User     helper.User
+		helper.User
+		Certificates  []helper.Certificate
+		LoginFailures []helper.LoginFailure
 	}{
-		Password: password,
-		User:     user,
+		User:          user,
+		Certificates:  certificates,
+		LoginFailures: failures,
 	}
 
-	err = c.templates["passwordGet"].Execute(writer, data)
+	err = c.templates["certificateList"].Execute(writer, data)
 	if err != nil {
 		return
 	}
 }
 
-func (c UserController) PasswordSet(writer ResponseWriter, request *Request) {
+// CertificateRenewal turns renewal by key on or off for one of the user's
+// certificates once they confirm.  It's off until turned on, so that a
+// certificate is only ever replaced by one its owner chose to allow.
+func (c UserController) CertificateRenewal(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
+	user, _ := middleware.CertUserFromRequest(request)
+
+	certSHA256, _ := middleware.StrFromRequest(request, "sha256")
+
+	certificate, found, err := c.repo.CertificateGet(user.UserID, certSHA256)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
+
 	if request.URL.RawQuery == "" {
-		err = helper.InputSensitive(writer, "New Password:\n(at least 8 characters, at least one upper case, lower case, digit and special character)")
+		name := opt.OfNonZero(certificate.Label).Or("this certificate")
+
+		if certificate.RenewByKey {
+			err = helper.InputPrompt(writer, fmt.Sprintf("Stop renewing %s by key?  A renewed certificate will need your password or a pairing code. (y/n)", name))
+		} else {
+			err = helper.InputPrompt(writer, fmt.Sprintf("Renew %s by key?  A new certificate made with the same key will take its place without your password. (y/n)", name))
+		}
+
 		return
 	}
 
-	user, _ := middleware.CertUserFromRequest(request)
+	answer, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		return
+	}
 
-	password := request.URL.RawQuery
+	if helper.IsYes(answer) {
+		err = c.repo.CertificateRenewByKey(user.UserID, certSHA256, !certificate.RenewByKey)
+		if err != nil {
+			return
+		}
+	}
 
-	p, length, upper, lower, digit, special := model.NewPassword(password)
-	if !(length && upper && lower && digit && special) {
-		response := bytes.Buffer{}
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/certificates", user.UserID))
+}
 
-		write := Must1(response.WriteString)
+// CertificateRevoke removes one of the user's certificates once they confirm.
+// The certificate making the request may be revoked only if the user has
+// another to sign in with.
+func (c UserController) CertificateRevoke(writer ResponseWriter, request *Request) {
+	var err error
 
-		write(Heredoc(`
-			# Insufficient password complexity
+	defer writeError(writer, err)
 
-			Try again and choose a password that meets the following requirements.
+	user, _ := middleware.CertUserFromRequest(request)
 
-			Asterisks indicate unsatisfied requirements.
+	certSHA256, _ := middleware.StrFromRequest(request, "sha256")
 
-			Password must be at least:
+	certificate, found, err := c.repo.CertificateGet(user.UserID, certSHA256)
+	if err != nil {
+		return
+	}
 
-		`))
+	if !found {
+		gemini.NotFound(writer, request)
+		return
+	}
 
-		write("* 8 characters")
+	if request.URL.RawQuery == "" {
+		name := opt.OfNonZero(certificate.Label).Or("this certificate")
 
-		if !length {
-			write(" (*)")
+		if certSHA256 == user.CertSHA256 {
+			err = helper.InputPrompt(writer, fmt.Sprintf("Revoke %s?  You're using it now, so this device will be signed out. (y/n)", name))
+		} else {
+			err = helper.InputPrompt(writer, fmt.Sprintf("Revoke %s?  The device using it will be signed out. (y/n)", name))
 		}
 
-		write("\n\nand at least one each of:\n\n")
+		return
+	}
 
-		write("* upper case")
+	answer, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		return
+	}
 
-		if !upper {
-			write(" (*)")
-		}
+	if !helper.IsYes(answer) {
+		err = helper.Redirect(writer, fmt.Sprintf("/users/%d/certificates", user.UserID))
+		return
+	}
 
-		write("\n* lower case")
+	err = c.repo.CertificateDelete(user.UserID, certSHA256)
+	if errors.Is(err, sqlrepo.ErrLastCertificate) {
+		_, err = writer.Write([]byte(fmt.Sprintf(Heredoc(`
+			This is your only certificate, so revoking it would lock you out.  Add another certificate first.
+			=> /users/%d/certificates Back to certificates
+		`), user.UserID)))
+		return
+	}
 
-		if !lower {
-			write(" (*)")
-		}
+	if err != nil {
+		return
+	}
 
-		write("\n* a digit")
+	if certSHA256 == user.CertSHA256 {
+		_, err = writer.Write([]byte(Heredoc(`
+			This certificate has been revoked.  Sign in again with one of your other certificates.
+			=> / Home
+		`)))
+		return
+	}
 
-		if !digit {
-			write(" (*)")
-		}
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/certificates", user.UserID))
+}
 
-		write("\n* a special character")
+func (c UserController) FirstNameSet(writer ResponseWriter, request *Request) {
+	var err error
 
-		if !special {
-			write(" (*)")
-		}
+	defer writeError(writer, err)
 
-		write("\n\n=> set Try again\n")
+	user, _ := middleware.CertUserFromRequest(request)
 
-		_, err = writer.Write(response.Bytes())
-		if err != nil {
-			return
-		}
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, "Enter your first name:")
+		return
 	}
 
-	err = c.repo.PasswordSet(user.UserID, p)
+	query, err := url.PathUnescape(request.URL.RawQuery)
 	if err != nil {
+		gemini.BadRequest(writer, request)
 		return
 	}
 
-	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+	firstName, ok := helper.ValidateName(query)
+	if !ok {
+		_, err = writer.Write([]byte(Heredoc(`
+			Name must be between 1 and 25 characters and may include letters, space, apostrophe and hyphen.
+			=> set Try again
+		`)))
+		return
+	}
+
+	err = c.repo.UpdateFirstName(user.UserID, firstName)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/lastname/set", user.UserID))
 }
 
-func (c UserController) ProfileGet(writer ResponseWriter, request *Request) {
+func (c UserController) Follow(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
+	user, _ := middleware.CertUserFromRequest(request)
+
 	userID, ok := middleware.Uint64FromRequest(request, "id")
 	if !ok {
 		gemini.BadRequest(writer, request)
@@ -301,88 +461,704 @@ func (c UserController) ProfileGet(writer ResponseWriter, request *Request) {
 		return
 	}
 
-	u, _ := middleware.CertUserFromRequest(request)
-
-	p, cs, found, err := c.repo.ProfileGet(userID)
-	if err != nil || !found {
+	if userID == user.UserID {
+		_, err = writer.Write([]byte(Heredoc(`
+			You can't follow yourself.
+			=> profile Back to profile
+		`)))
 		return
 	}
 
-	certificates := make([]helper.Certificate, len(cs))
-
-	for i, certificate := range cs {
-		certificates[i] = helper.Certificate{
-			CreatedAt: model.LongHumanTime(certificate.CreatedAt),
-			ExpireAt:  model.LongHumanTime(certificate.ExpireAt),
-		}
+	_, found, err := c.repo.Get(userID)
+	if err != nil {
+		return
 	}
 
-	profile := helper.Profile{
-		Avatar:        p.Avatar,
-		Certificates:  certificates,
-		CreatedAt:     model.LongHumanTime(p.CreatedAt),
-		FirstName:     p.FirstName,
-		LastName:      p.LastName,
-		LastSeen:      model.HumanTime(p.LastSeen),
-		Me:            userID == u.UserID,
-		PasswordFound: p.Password.Valid,
-		UserID:        fmt.Sprintf("%d", userID),
-		UserName:      p.UserName,
+	if !found {
+		gemini.NotFound(writer, request)
+		return
 	}
 
-	err = c.templates["profileGet"].Execute(writer, profile)
+	err = c.repo.Follow(user.UserID, userID)
 	if err != nil {
 		return
 	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", userID))
 }
 
-func (c UserController) Routes() map[string]Handler {
-	return map[string]Handler{
-		"/users/{id}/avatar/set":    middleware.EyesOnly(HandlerFunc(c.AvatarSet)),
-		"/users/{id}/firstname/set": middleware.EyesOnly(HandlerFunc(c.FirstNameSet)),
-		"/users/{id}/lastname/set":  middleware.EyesOnly(HandlerFunc(c.LastNameSet)),
-		"/users/{id}/password":      HandlerFunc(c.PasswordGet),
-		"/users/{id}/password/set":  middleware.EyesOnly(HandlerFunc(c.PasswordSet)),
-		"/users/{id}/profile":       HandlerFunc(c.ProfileGet),
-		"/users/{id}/username/set":  middleware.EyesOnly(HandlerFunc(c.UserNameSet)),
-	}
+func (c UserController) FollowerList(writer ResponseWriter, request *Request) {
+	c.followList(writer, request, "%s's followers", c.repo.FollowerList)
 }
 
-func (c UserController) ServeGemini(writer ResponseWriter, request *Request) {
-	if c.handler == nil {
-		c.handler = c.Handler()
+func (c UserController) FollowingList(writer ResponseWriter, request *Request) {
+	c.followList(writer, request, "%s follows", c.repo.FollowingList)
+}
+
+func (c UserController) Handler(routes ...map[string]Handler) *Mux {
+	handlers := opt.OfFirst(routes).Or(c.Routes())
+
+	router := mux.NewMux()
+
+	for _, pattern := range routePatterns(handlers) {
+		router.AddRoute(pattern, handlers[pattern])
 	}
 
-	c.handler.ServeGemini(writer, request)
+	return router
 }
 
-func (c UserController) UserNameSet(writer ResponseWriter, request *Request) {
+func (c UserController) LastNameSet(writer ResponseWriter, request *Request) {
 	var err error
 
 	defer writeError(writer, err)
 
-	user, _ := middleware.CertUserFromRequest(request)
+	u, _ := middleware.CertUserFromRequest(request)
 
 	if request.URL.RawQuery == "" {
-		err = helper.InputPrompt(writer, "Choose your (permanent) username:")
+		err = helper.InputPrompt(writer, "Enter your last name:")
+		return
+	}
+
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
 		return
 	}
 
-	userName, ok := helper.ValidateUserName(request.URL.RawQuery)
+	lastName, ok := helper.ValidateName(query)
 	if !ok {
 		_, err = writer.Write([]byte(Heredoc(`
-			Username must be between 5 and 50 characters with no spaces or emojis.
+			Name must be between 1 and 25 characters and may include letters, space, apostrophe and hyphen.
 			=> set Try again
 		`)))
+		return
+	}
+
+	err = c.repo.UpdateLastName(u.UserID, lastName)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", u.UserID))
+}
+
+func (c UserController) List(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	users, err := c.repo.List()
+	if err != nil {
+		return
+	}
+
+	err = c.userList(writer, request, "Members", users)
+}
+
+// PairingCodeAdd makes a one-time code that adds the certificate of a new
+// device to the user's account, so the user doesn't need a password to do it.
+func (c UserController) PairingCodeAdd(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	code, err := helper.NewPairingCode()
+	if err != nil {
+		return
+	}
+
+	err = c.repo.PairingCodeAdd(user.UserID, helper.PairingCodeSHA256(code), helper.PairingCodeLifetime)
+	if err != nil {
+		return
+	}
+
+	_, err = writer.Write([]byte(fmt.Sprintf(Heredoc(`
+		## Pair a new device
+
+		Your pairing code is:
+
+		%s
+
+		On your new device, make a certificate for this capsule, then open the link below and enter the code.  The code works once and expires in %d minutes.  Making another code cancels this one.
+
+		=> /register/pairing/check 📲 Pair this device
+		=> /users/%d/certificates Back to certificates
+	`), code, int(helper.PairingCodeLifetime.Minutes()), user.UserID)))
+}
+
+func (c UserController) PasswordGet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	password, _, err := c.repo.PasswordGet(user.UserID)
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Password model.Password
+	}{
+		User:     user,
+		Password: password,
+	}
+
+	err = c.templates["passwordGet"].Execute(writer, data)
+	if err != nil {
+		return
+	}
+}
+
+func (c UserController) PasswordSet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputSensitive(writer, "New Password:\n(at least 8 characters, at least one upper case, lower case, digit and special character)")
+		return
+	}
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	password := request.URL.RawQuery
+
+	p, length, upper, lower, digit, special := model.NewPassword(password)
+	if !(length && upper && lower && digit && special) {
+		response := bytes.Buffer{}
+
+		write := Must1(response.WriteString)
+
+		write(Heredoc(`
+			# Insufficient password complexity
+
+			Try again and choose a password that meets the following requirements.
+
+			Asterisks indicate unsatisfied requirements.
+
+			Password must be at least:
+
+		`))
+
+		write("* 8 characters")
+
+		if !length {
+			write(" (*)")
+		}
+
+		write("\n\nand at least one each of:\n\n")
+
+		write("* upper case")
+
+		if !upper {
+			write(" (*)")
+		}
+
+		write("\n* lower case")
+
+		if !lower {
+			write(" (*)")
+		}
+
+		write("\n* a digit")
+
+		if !digit {
+			write(" (*)")
+		}
+
+		write("\n* a special character")
+
+		if !special {
+			write(" (*)")
+		}
+
+		write("\n\n=> set Try again\n")
+
+		_, err = writer.Write(response.Bytes())
 		if err != nil {
 			return
 		}
 	}
 
-	err = c.repo.UpdateUserName(user.UserID, userName)
-	if err != nil { // TODO: userName conflict
+	err = c.repo.PasswordSet(user.UserID, p)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c UserController) ProfileFieldAdd(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	prompt := "Name your new profile field, such as Favorite food:"
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, prompt)
 		return
 	}
 
-	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/avatar/set", user.UserID))
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	name, ok := helper.ValidateProfileFieldName(query)
+	if !ok {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, field names are up to 25 letters, numbers, spaces, apostrophes and hyphens. %s", prompt))
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/fields/%s/set", user.UserID, url.PathEscape(name)))
+}
+
+func (c UserController) ProfileFieldDelete(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	name, ok := middleware.StrFromRequest(request, "name")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no field name")
+		return
+	}
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Remove %s from your profile? (y/n)", name))
+		return
+	}
+
+	answer, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		return
+	}
+
+	if helper.IsYes(answer) {
+		err = c.repo.ProfileFieldDelete(user.UserID, name)
+		if err != nil {
+			return
+		}
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c UserController) ProfileFieldSet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	name, ok := middleware.StrFromRequest(request, "name")
+	if ok {
+		name, ok = helper.ValidateProfileFieldName(name)
+	}
+
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("bad field name")
+		return
+	}
+
+	prompt := fmt.Sprintf("Enter your %s:", name)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, prompt)
+		return
+	}
+
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	value, ok := helper.ValidateProfileFieldValue(query)
+	if !ok {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, that must be between 1 and 100 characters. %s", prompt))
+		return
+	}
+
+	err = c.repo.ProfileFieldSet(user.UserID, name, value)
+	if errors.Is(err, sqlrepo.ErrProfileFieldLimit) {
+		_, err = writer.Write([]byte(fmt.Sprintf(Heredoc(`
+			You already have as many profile fields as you can.  Remove one first.
+			=> /users/%d/profile Back to profile
+		`), user.UserID)))
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c UserController) ProfileGet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	userID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no user id")
+		return
+	}
+
+	u, _ := middleware.CertUserFromRequest(request)
+
+	p, cs, found, err := c.repo.ProfileGet(userID)
+	if err != nil || !found {
+		return
+	}
+
+	certificates := slice.Map(helper.CertificateFromModel, cs)
+
+	followers, followings, err := c.repo.FollowCounts(userID)
+	if err != nil {
+		return
+	}
+
+	following := false
+
+	if userID != u.UserID {
+		following, err = c.repo.IsFollowing(u.UserID, userID)
+		if err != nil {
+			return
+		}
+	}
+
+	fields, err := c.repo.ProfileFieldList(userID)
+	if err != nil {
+		return
+	}
+
+	gramCount, sparkleCount, err := c.gramRepo.UserCounts(userID)
+	if err != nil {
+		return
+	}
+
+	page, ok := pageFromRequest(request, c.pageSize)
+	if !ok {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	grams, more, err := c.gramRepo.ListByUser(userID, u.UserID, page)
+	if err != nil {
+		return
+	}
+
+	pins, err := c.gramRepo.PinList(userID, u.UserID)
+	if err != nil {
+		return
+	}
+
+	views, err := gramsFromModel(c.gramRepo, append(pins, grams...), request.URL.RequestURI())
+	if err != nil {
+		return
+	}
+
+	profile := helper.Profile{
+		Avatar:         p.Avatar,
+		Bio:            p.Bio,
+		Certificates:   certificates,
+		CreatedAt:      model.LongHumanTime(p.CreatedAt),
+		Fields:         slice.Map(helper.ProfileFieldFromModel, fields),
+		FirstName:      p.FirstName,
+		FollowerCount:  followers,
+		Following:      following,
+		FollowingCount: followings,
+		GramCount:      gramCount,
+		LastName:       p.LastName,
+		LastSeen:       model.HumanTime(p.LastSeen),
+		Me:             userID == u.UserID,
+		PasswordFound:  p.Password.Valid,
+		Pronouns:       p.Pronouns,
+		SparkleCount:   sparkleCount,
+		UserID:         fmt.Sprintf("%d", userID),
+		UserName:       p.UserName,
+	}
+
+	data := struct {
+		helper.User
+		Grams   []helper.Gram
+		Pager   helper.Pager
+		Pins    []helper.Gram
+		Profile helper.Profile
+	}{
+		User:    u,
+		Grams:   views[len(pins):],
+		Pager:   newPager(fmt.Sprintf("/users/%d/profile", userID), grams, page, more),
+		Pins:    views[:len(pins)],
+		Profile: profile,
+	}
+
+	err = c.templates["profileGet"].Execute(writer, data)
+	if err != nil {
+		return
+	}
+}
+
+func (c UserController) PronounsSet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	prompt := "Enter your pronouns, such as she/her, or a space to clear them:"
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, prompt)
+		return
+	}
+
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	pronouns, ok := helper.ValidatePronouns(query)
+	if !ok {
+		err = helper.InputPrompt(writer, fmt.Sprintf("Sorry, pronouns are up to 30 letters, spaces, slashes and hyphens. %s", prompt))
+		return
+	}
+
+	err = c.repo.UpdatePronouns(user.UserID, pronouns)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", user.UserID))
+}
+
+func (c UserController) Routes() map[string]Handler {
+	return map[string]Handler{
+		"/users":                                    HandlerFunc(c.List),
+		"/users/search":                             HandlerFunc(c.Search),
+		"/users/{id}/avatar":                        middleware.EyesOnly(HandlerFunc(c.AvatarPick)),
+		"/users/{id}/avatar/set":                    middleware.EyesOnly(HandlerFunc(c.AvatarSet)),
+		"/users/{id}/avatar/{category}":             middleware.EyesOnly(HandlerFunc(c.AvatarPick)),
+		"/users/{id}/bio/set":                       middleware.EyesOnly(HandlerFunc(c.BioSet)),
+		"/users/{id}/certificates":                  middleware.EyesOnly(HandlerFunc(c.CertificateList)),
+		"/users/{id}/certificates/pair":             middleware.EyesOnly(HandlerFunc(c.PairingCodeAdd)),
+		"/users/{id}/certificates/{sha256}/label":   middleware.EyesOnly(HandlerFunc(c.CertificateLabel)),
+		"/users/{id}/certificates/{sha256}/renewal": middleware.EyesOnly(HandlerFunc(c.CertificateRenewal)),
+		"/users/{id}/certificates/{sha256}/revoke":  middleware.EyesOnly(HandlerFunc(c.CertificateRevoke)),
+		"/users/{id}/fields/add":                    middleware.EyesOnly(HandlerFunc(c.ProfileFieldAdd)),
+		"/users/{id}/fields/{name}/delete":          middleware.EyesOnly(HandlerFunc(c.ProfileFieldDelete)),
+		"/users/{id}/fields/{name}/set":             middleware.EyesOnly(HandlerFunc(c.ProfileFieldSet)),
+		"/users/{id}/firstname/set":                 middleware.EyesOnly(HandlerFunc(c.FirstNameSet)),
+		"/users/{id}/follow":                        HandlerFunc(c.Follow),
+		"/users/{id}/followers":                     HandlerFunc(c.FollowerList),
+		"/users/{id}/following":                     HandlerFunc(c.FollowingList),
+		"/users/{id}/lastname/set":                  middleware.EyesOnly(HandlerFunc(c.LastNameSet)),
+		"/users/{id}/password":                      HandlerFunc(c.PasswordGet),
+		"/users/{id}/password/set":                  middleware.EyesOnly(HandlerFunc(c.PasswordSet)),
+		"/users/{id}/profile":                       HandlerFunc(c.ProfileGet),
+		"/users/{id}/pronouns/set":                  middleware.EyesOnly(HandlerFunc(c.PronounsSet)),
+		"/users/{id}/unfollow":                      HandlerFunc(c.Unfollow),
+		"/users/{id}/username/set":                  middleware.EyesOnly(HandlerFunc(c.UserNameSet)),
+	}
+}
+
+// Search asks for a name and shows the members whose username, first name or
+// last name contains it.
+func (c UserController) Search(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, "Search members by name:")
+		return
+	}
+
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	// collapse whitespace so that the search can't break out of its heading
+	query = strings.Join(strings.Fields(query), " ")
+
+	if query == "" {
+		err = helper.InputPrompt(writer, "Sorry, your search is empty. Search members by name:")
+		return
+	}
+
+	users, err := c.repo.Search(query)
+	if err != nil {
+		return
+	}
+
+	err = c.userList(writer, request, fmt.Sprintf("Members matching %q", query), users)
+}
+
+func (c UserController) ServeGemini(writer ResponseWriter, request *Request) {
+	if c.handler == nil {
+		c.handler = c.Handler()
+	}
+
+	c.handler.ServeGemini(writer, request)
+}
+
+func (c UserController) Unfollow(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	userID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no user id")
+		return
+	}
+
+	err = c.repo.Unfollow(user.UserID, userID)
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/profile", userID))
+}
+
+func (c UserController) UserNameSet(writer ResponseWriter, request *Request) {
+	var err error
+
+	defer writeError(writer, err)
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	if request.URL.RawQuery == "" {
+		err = helper.InputPrompt(writer, "Choose your (permanent) username:")
+		return
+	}
+
+	query, err := url.PathUnescape(request.URL.RawQuery)
+	if err != nil {
+		gemini.BadRequest(writer, request)
+		return
+	}
+
+	userName, ok := helper.ValidateUserName(query)
+	if !ok {
+		_, err = writer.Write([]byte(Heredoc(`
+			Username must be between 5 and 50 characters with no spaces or emojis, using the letters of a single alphabet.
+			=> set Try again
+		`)))
+		return
+	}
+
+	err = c.repo.UpdateUserName(user.UserID, userName, helper.UserNameSkeleton(userName))
+	if errors.Is(err, sqlrepo.ErrUserNameTaken) {
+		_, err = writer.Write([]byte(Heredoc(`
+			That username is taken, or looks too much like one that is.
+			=> set Try again
+		`)))
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = helper.Redirect(writer, fmt.Sprintf("/users/%d/avatar", user.UserID))
+}
+
+func (c UserController) followList(writer ResponseWriter, request *Request, heading string, list func(uint64) ([]model.User, error)) {
+	var err error
+
+	defer writeError(writer, err)
+
+	userID, ok := middleware.Uint64FromRequest(request, "id")
+	if !ok {
+		gemini.BadRequest(writer, request)
+		log.Print("no user id")
+		return
+	}
+
+	user, _ := middleware.CertUserFromRequest(request)
+
+	p, _, found, err := c.repo.ProfileGet(userID)
+	if err != nil || !found {
+		return
+	}
+
+	users, err := list(userID)
+	if err != nil {
+		return
+	}
+
+	data := struct {
+		helper.User
+		Heading   string
+		Members   []helper.Member
+		ProfileID uint64
+	}{
+		User:      user,
+		Heading:   fmt.Sprintf(heading, p.UserName),
+		Members:   slice.Map(helper.MemberFromModel, users),
+		ProfileID: userID,
+	}
+
+	err = c.templates["followList"].Execute(writer, data)
+}
+
+// userList renders users with follow links for those the viewer doesn't
+// follow yet.
+func (c UserController) userList(writer ResponseWriter, request *Request, heading string, users []model.User) (err error) {
+	user, _ := middleware.CertUserFromRequest(request)
+
+	following, err := c.repo.FollowingList(user.UserID)
+	if err != nil {
+		return
+	}
+
+	followingIDs := make(map[uint64]bool)
+
+	for _, u := range following {
+		followingIDs[u.ID] = true
+	}
+
+	members := make([]helper.Member, len(users))
+
+	for i, u := range users {
+		members[i] = helper.MemberFromModel(u)
+		members[i].Following = followingIDs[u.ID]
+		members[i].Self = u.ID == user.UserID
+	}
+
+	data := struct {
+		helper.User
+		Heading string
+		Members []helper.Member
+	}{
+		User:    user,
+		Heading: heading,
+		Members: members,
+	}
+
+	return c.templates["userList"].Execute(writer, data)
 }
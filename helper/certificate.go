@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"log"
+)
+
+// The functions below read a client certificate in the DER form that gemini
+// passes as the request certificate's Key.
+
+// CertificateExpireAt returns when a client certificate expires, or 0, for
+// never, if it can't be read.
+func CertificateExpireAt(key string) int64 {
+	certificate, err := x509.ParseCertificate([]byte(key))
+	if err != nil {
+		log.Print(err)
+		return 0
+	}
+
+	return certificate.NotAfter.Unix()
+}
+
+// CertificateKeySHA256 returns the hex SHA-256 of a client certificate's
+// public key, or "" if it can't be read.  Clients that renew a certificate
+// with the same key pair keep the same key hash.
+func CertificateKeySHA256(key string) string {
+	certificate, err := x509.ParseCertificate([]byte(key))
+	if err != nil {
+		log.Print(err)
+		return ""
+	}
+
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	return hex.EncodeToString(hash[:])
+}
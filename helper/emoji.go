@@ -0,0 +1,361 @@
+package helper
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const (
+	keycap              = '\u20E3'
+	variationSelector16 = '\uFE0F'
+	zeroWidthJoiner     = '\u200D'
+)
+
+var (
+	// emojiBases are the code points that can begin an emoji, other than
+	// keycap bases and regional indicators, which have rules of their own.
+	// They follow the Extended_Pictographic property of Unicode's emoji data,
+	// leaving out unassigned code points.
+	emojiBases = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{0x00A9, 0x00AE, 5},
+			{0x203C, 0x2049, 13},
+			{0x2122, 0x2139, 23},
+			{0x2194, 0x2199, 1},
+			{0x21A9, 0x21AA, 1},
+			{0x231A, 0x231B, 1},
+			{0x2328, 0x23CF, 167},
+			{0x23E9, 0x23F3, 1},
+			{0x23F8, 0x23FA, 1},
+			{0x24C2, 0x24C2, 1},
+			{0x25AA, 0x25AB, 1},
+			{0x25B6, 0x25C0, 10},
+			{0x25FB, 0x25FE, 1},
+			{0x2600, 0x27BF, 1},
+			{0x2934, 0x2935, 1},
+			{0x2B05, 0x2B07, 1},
+			{0x2B1B, 0x2B1C, 1},
+			{0x2B50, 0x2B55, 5},
+			{0x3030, 0x303D, 13},
+			{0x3297, 0x3299, 2},
+		},
+		R32: []unicode.Range32{
+			{0x1F004, 0x1F0CF, 203},
+			{0x1F170, 0x1F171, 1},
+			{0x1F17E, 0x1F17F, 1},
+			{0x1F18E, 0x1F18E, 1},
+			{0x1F191, 0x1F19A, 1},
+			{0x1F201, 0x1F202, 1},
+			{0x1F21A, 0x1F22F, 21},
+			{0x1F232, 0x1F23A, 1},
+			{0x1F250, 0x1F251, 1},
+			{0x1F300, 0x1F3FA, 1},
+			{0x1F400, 0x1F6FF, 1},
+			{0x1F7E0, 0x1F7EB, 1},
+			{0x1F7F0, 0x1F7F0, 1},
+			{0x1F90C, 0x1F9FF, 1},
+			{0x1FA70, 0x1FAFF, 1},
+		},
+		LatinOffset: 1,
+	}
+
+	// emojiPresentation are the emoji bases that are shown as emoji on their
+	// own, following the Emoji_Presentation property.  The rest, such as © and
+	// ☺, are shown as text unless a variation selector or skin tone follows.
+	emojiPresentation = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{0x231A, 0x231B, 1},
+			{0x23E9, 0x23EC, 1},
+			{0x23F0, 0x23F3, 3},
+			{0x25FD, 0x25FE, 1},
+			{0x2614, 0x2615, 1},
+			{0x2648, 0x2653, 1},
+			{0x267F, 0x267F, 1},
+			{0x2693, 0x2693, 1},
+			{0x26A1, 0x26A1, 1},
+			{0x26AA, 0x26AB, 1},
+			{0x26BD, 0x26BE, 1},
+			{0x26C4, 0x26C5, 1},
+			{0x26CE, 0x26CE, 1},
+			{0x26D4, 0x26D4, 1},
+			{0x26EA, 0x26EA, 1},
+			{0x26F2, 0x26F3, 1},
+			{0x26F5, 0x26F5, 1},
+			{0x26FA, 0x26FD, 3},
+			{0x2705, 0x2705, 1},
+			{0x270A, 0x270B, 1},
+			{0x2728, 0x2728, 1},
+			{0x274C, 0x274E, 2},
+			{0x2753, 0x2755, 1},
+			{0x2757, 0x2757, 1},
+			{0x2795, 0x2797, 1},
+			{0x27B0, 0x27BF, 15},
+			{0x2B1B, 0x2B1C, 1},
+			{0x2B50, 0x2B55, 5},
+		},
+		R32: []unicode.Range32{
+			{0x1F004, 0x1F0CF, 203},
+			{0x1F18E, 0x1F18E, 1},
+			{0x1F191, 0x1F19A, 1},
+			{0x1F201, 0x1F21A, 25},
+			{0x1F22F, 0x1F22F, 1},
+			{0x1F232, 0x1F236, 1},
+			{0x1F238, 0x1F23A, 1},
+			{0x1F250, 0x1F251, 1},
+			{0x1F300, 0x1F320, 1},
+			{0x1F32D, 0x1F335, 1},
+			{0x1F337, 0x1F37C, 1},
+			{0x1F37E, 0x1F393, 1},
+			{0x1F3A0, 0x1F3CA, 1},
+			{0x1F3CF, 0x1F3D3, 1},
+			{0x1F3E0, 0x1F3F0, 1},
+			{0x1F3F4, 0x1F3F4, 1},
+			{0x1F3F8, 0x1F43E, 1},
+			{0x1F440, 0x1F440, 1},
+			{0x1F442, 0x1F4FC, 1},
+			{0x1F4FF, 0x1F53D, 1},
+			{0x1F54B, 0x1F54E, 1},
+			{0x1F550, 0x1F567, 1},
+			{0x1F57A, 0x1F57A, 1},
+			{0x1F595, 0x1F596, 1},
+			{0x1F5A4, 0x1F5A4, 1},
+			{0x1F5FB, 0x1F64F, 1},
+			{0x1F680, 0x1F6C5, 1},
+			{0x1F6CC, 0x1F6CC, 1},
+			{0x1F6D0, 0x1F6D2, 1},
+			{0x1F6D5, 0x1F6D7, 1},
+			{0x1F6DC, 0x1F6DF, 1},
+			{0x1F6EB, 0x1F6EC, 1},
+			{0x1F6F4, 0x1F6FC, 1},
+			{0x1F7E0, 0x1F7EB, 1},
+			{0x1F7F0, 0x1F7F0, 1},
+			{0x1F90C, 0x1F93A, 1},
+			{0x1F93C, 0x1F945, 1},
+			{0x1F947, 0x1F9FF, 1},
+			{0x1FA70, 0x1FA7C, 1},
+			{0x1FA80, 0x1FA88, 1},
+			{0x1FA90, 0x1FABD, 1},
+			{0x1FABF, 0x1FAC5, 1},
+			{0x1FACE, 0x1FADB, 1},
+			{0x1FAE0, 0x1FAE8, 1},
+			{0x1FAF0, 0x1FAF8, 1},
+		},
+	}
+
+	// emojiModifiers may follow an emoji base within the same emoji: skin
+	// tones, and the tag characters that spell out subdivision flags such as
+	// Scotland's.
+	emojiModifiers = &unicode.RangeTable{
+		R32: []unicode.Range32{
+			{0x1F3FB, 0x1F3FF, 1},
+			{0xE0020, 0xE007F, 1},
+		},
+	}
+
+	keycapBases = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{0x0023, 0x002A, 7},
+			{0x0030, 0x0039, 1},
+		},
+		LatinOffset: 2,
+	}
+
+	regionalIndicators = &unicode.RangeTable{
+		R32: []unicode.Range32{
+			{0x1F1E6, 0x1F1FF, 1},
+		},
+	}
+
+	skinTones = &unicode.RangeTable{
+		R32: []unicode.Range32{
+			{0x1F3FB, 0x1F3FF, 1},
+		},
+	}
+)
+
+// EmojiPageSize is how many emoji are shown on each page of a category.
+const EmojiPageSize = 30
+
+type (
+	// EmojiCategory is a named group of emoji that can be picked as an avatar.
+	EmojiCategory struct {
+		Emoji []string
+		Name  string
+		Slug  string
+	}
+
+	// EmojiChoice is an emoji offered by the picker along with the query that
+	// sets it as an avatar.
+	EmojiChoice struct {
+		Emoji string
+		Query string
+	}
+)
+
+// EmojiCatalog is the emoji offered by the avatar picker, by category.  Every
+// emoji in it is accepted by ValidateAvatar.
+var EmojiCatalog = []EmojiCategory{
+	{
+		Name: "Smileys",
+		Slug: "smileys",
+		Emoji: strings.Fields(`
+			😀 😃 😄 😁 😆 😅 🤣 😂 🙂 🙃 😉 😊 😇 🥰 😍 🤩 😘 😗 😚 😙
+			😋 😛 😜 🤪 😝 🤑 🤗 🤭 🤫 🤔 🤐 🤨 😐 😑 😶 😏 😒 🙄 😬 🤥
+			😌 😔 😪 🤤 😴 😷 🤒 🤕 🤢 🤮 🤧 🥵 🥶 🥴 😵 🤯 🤠 🥳 😎 🤓
+			🧐 😕 😟 🙁 😮 😯 😲 😳 🥺 😦 😧 😨 😰 😥 😢 😭 😱 😖 😣 😞
+			😓 😩 😫 🥱 😤 😡 😠 🤬 😈 👿 💀 💩 🤡 👹 👺 👻 👽 👾 🤖
+		`),
+	},
+	{
+		Name: "People",
+		Slug: "people",
+		Emoji: strings.Fields(`
+			👶 🧒 👦 👧 🧑 👱 👨 🧔 👩 🧓 👴 👵 🙍 🙎 🙅 🙆 💁 🙋 🧏 🙇
+			🤦 🤷 👮 💂 👷 🤴 👸 👳 👲 🧕 🤵 👰 🤰 🤱 👼 🎅 🤶 🦸 🦹 🧙
+			🧚 🧛 🧜 🧝 🧞 🧟 💆 💇 🚶 🧍 🧎 🏃 💃 🕺 👯 🧖 🧗 🤺 🏇 🏂
+		`),
+	},
+	{
+		Name: "Animals",
+		Slug: "animals",
+		Emoji: strings.Fields(`
+			🐵 🐒 🦍 🦧 🐶 🐕 🦮 🐩 🐺 🦊 🦝 🐱 🐈 🦁 🐯 🐅 🐆 🐴 🐎 🦄
+			🦓 🦌 🐮 🐂 🐃 🐄 🐷 🐖 🐗 🐽 🐏 🐑 🐐 🐪 🐫 🦙 🦒 🐘 🦏 🦛
+			🐭 🐁 🐀 🐹 🐰 🐇 🦔 🦇 🐻 🐨 🐼 🦥 🦦 🦨 🦘 🦡 🐾 🦃 🐔 🐓
+			🐣 🐤 🐥 🐦 🐧 🦅 🦆 🦢 🦉 🦩 🦚 🦜 🐸 🐊 🐢 🦎 🐍 🐲 🐉 🦕
+			🦖 🐳 🐋 🐬 🐟 🐠 🐡 🦈 🐙 🐚 🐌 🦋 🐛 🐜 🐝 🐞 🦗 🦂 🦟 🦠
+		`),
+	},
+	{
+		Name: "Nature",
+		Slug: "nature",
+		Emoji: strings.Fields(`
+			💐 🌸 💮 🌹 🥀 🌺 🌻 🌼 🌷 🌱 🌲 🌳 🌴 🌵 🌾 🌿 🍀 🍁 🍂 🍃
+			🍄 🌰 🌍 🌎 🌏 🌑 🌒 🌓 🌔 🌕 🌖 🌗 🌘 🌙 🌚 🌛 🌜 🌝 🌞 🌟
+			🌠 🌌 🌈 🌀 🌊 🔥 💧
+		`),
+	},
+	{
+		Name: "Food & drink",
+		Slug: "food",
+		Emoji: strings.Fields(`
+			🍇 🍈 🍉 🍊 🍋 🍌 🍍 🥭 🍎 🍏 🍐 🍑 🍒 🍓 🥝 🍅 🥥 🥑 🍆 🥔
+			🥕 🌽 🥒 🥬 🥦 🧄 🧅 🥜 🍞 🥐 🥖 🥨 🥯 🥞 🧇 🧀 🍖 🍗 🥩 🥓
+			🍔 🍟 🍕 🌭 🥪 🌮 🌯 🥙 🧆 🥚 🍳 🥘 🍲 🥣 🥗 🍿 🧈 🧂 🥫 🍱
+			🍘 🍙 🍚 🍛 🍜 🍝 🍠 🍢 🍣 🍤 🍥 🥮 🍡 🥟 🥠 🥡 🦀 🦞 🦐 🦑
+			🦪 🍦 🍧 🍨 🍩 🍪 🎂 🍰 🧁 🥧 🍫 🍬 🍭 🍮 🍯 🍼 🥛 🍵 🍶 🍾
+			🍷 🍸 🍹 🍺 🍻 🥂 🥃 🥤 🧃 🧉 🧊
+		`),
+	},
+	{
+		Name: "Activities",
+		Slug: "activities",
+		Emoji: strings.Fields(`
+			🎃 🎄 🎆 🎇 🧨 🎈 🎉 🎊 🎋 🎍 🎎 🎏 🎐 🎑 🧧 🎀 🎁 🎫 🏆 🏅
+			🥇 🥈 🥉 🥎 🏀 🏐 🏈 🏉 🎾 🥏 🎳 🏏 🏑 🏒 🥍 🏓 🏸 🥊 🥋 🥅
+			🎣 🤿 🎽 🎿 🛷 🥌 🎯 🎱 🔮 🧿 🎮 🎰 🎲 🧩 🧸 🎴 🎭 🎨 🧵 🧶
+			🎤 🎧 🎷 🎸 🎹 🎺 🎻 🥁
+		`),
+	},
+	{
+		Name: "Travel & places",
+		Slug: "travel",
+		Emoji: strings.Fields(`
+			🚗 🚕 🚙 🚌 🚎 🚓 🚑 🚒 🚐 🚚 🚛 🚜 🛵 🚲 🛴 🛹 🚨 🚃 🚋 🚞
+			🚝 🚄 🚅 🚈 🚂 🚆 🚇 🚊 🚉 🛫 🛬 💺 🚁 🚟 🚠 🚡 🚀 🛸 🚢 🛶
+			🚤 🗼 🗽 🗿 🏰 🏯 🎡 🎢 🎠 🗻 🌋 🏠 🏡 🏢 🏣 🏤 🏥 🏦 🏨 🏩
+			🏪 🏫 🏬 🏭 🗾 🌁 🌃 🌄 🌅 🌆 🌇 🌉
+		`),
+	},
+	{
+		Name: "Objects",
+		Slug: "objects",
+		Emoji: strings.Fields(`
+			👓 🥽 🥼 🦺 👔 👕 👖 🧣 🧤 🧥 🧦 👗 👘 🥻 👙 👚 👛 👜 👝 🎒
+			👞 👟 🥾 🥿 👠 👡 👢 👑 👒 🎩 🎓 🧢 💄 💍 💎 🔔 🎼 🎵 🎶 📱
+			💻 💾 💿 📀 🎥 🎬 📺 📷 📸 📹 📼 🔍 💡 🔦 🏮 📕 📖 📚 📜 📰
+			🔖 💰 💵 💳 📦 📫 📮 📝 💼 📁 📅 📈 📌 📎 🔒 🔑 🔨 🔧 🧲 🧪
+			🔬 🔭 📡 💊 🚪 🚽 🚿 🛁 🧴 🧹 🧺 🧼 🧽 🛒
+		`),
+	},
+	{
+		Name: "Hearts & symbols",
+		Slug: "symbols",
+		Emoji: strings.Fields(`
+			💘 💝 💖 💗 💓 💞 💕 💟 💔 🧡 💛 💚 💙 💜 🤎 🖤 🤍 💯 💢 💥
+			💫 💦 💨 💬 💭 💤 🔴 🟠 🟡 🟢 🔵 🟣 🟤 🟥 🟧 🟨 🟩 🟦 🟪 🟫
+			🔶 🔷 🔸 🔹 🔺 🔻 💠 🔘 🔳 🔲 🏁 🚩 🎌 🏴
+		`),
+	},
+}
+
+// EmojiCategoryBySlug returns the catalog category with the given slug.
+func EmojiCategoryBySlug(slug string) (_ EmojiCategory, found bool) {
+	for _, category := range EmojiCatalog {
+		if category.Slug == slug {
+			return category, true
+		}
+	}
+
+	return
+}
+
+// EmojiChoiceFromEmoji makes an emoji choice whose query can be appended to
+// the avatar input URL to set the emoji without typing it.
+func EmojiChoiceFromEmoji(emoji string) EmojiChoice {
+	return EmojiChoice{
+		Emoji: emoji,
+		Query: url.PathEscape(emoji),
+	}
+}
+
+// isEmoji reports whether cluster, a single grapheme cluster, is an emoji.
+// That covers lone pictographs, those with a variation selector or skin
+// tone (which pictographs shown as text by default must have), sequences of
+// them joined with zero width joiners, flags made of regional indicators or
+// tags, and keycaps.
+func isEmoji(cluster string) bool {
+	runes := []rune(cluster)
+
+	if len(runes) == 0 {
+		return false
+	}
+
+	switch first := runes[0]; {
+	case unicode.Is(keycapBases, first):
+		rest := string(runes[1:])
+
+		return rest == string(keycap) || rest == string(variationSelector16)+string(keycap)
+	case unicode.Is(regionalIndicators, first):
+		return len(runes) == 2 && unicode.Is(regionalIndicators, runes[1])
+	case !unicode.Is(emojiBases, first):
+		return false
+	case !unicode.Is(emojiPresentation, first):
+		// a base shown as text by default, such as ©, is only an emoji when
+		// asked to be one
+		if len(runes) < 2 || !(runes[1] == variationSelector16 || unicode.Is(skinTones, runes[1])) {
+			return false
+		}
+	}
+
+	for i, r := range runes[1:] {
+		switch {
+		case r == variationSelector16, unicode.Is(emojiModifiers, r):
+		case r == zeroWidthJoiner:
+			// a joiner must join two emoji
+			if i+2 >= len(runes) || !unicode.Is(emojiBases, runes[i+2]) {
+				return false
+			}
+		case unicode.Is(emojiBases, r):
+			// an emoji base can only follow a joiner
+			if runes[i] != zeroWidthJoiner {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,49 @@
+package helper
+
+import "testing"
+
+func TestValidateAvatar(t *testing.T) {
+	tests := []struct {
+		name   string
+		avatar string
+		want   bool
+	}{
+		{name: "family", avatar: "👩‍👧", want: true},
+		{name: "flag", avatar: "🇺🇸", want: true},
+		{name: "text heart with variation selector", avatar: "❤️", want: true},
+		{name: "skin tone", avatar: "👍🏽", want: true},
+		{name: "keycap", avatar: "1️⃣", want: true},
+		{name: "subdivision flag", avatar: "🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f", want: true},
+		{name: "text base with skin tone", avatar: "☝🏽", want: true},
+		{name: "copyright with variation selector", avatar: "©️", want: true},
+		{name: "surrounding space", avatar: " 🐱 ", want: true},
+		{name: "letter", avatar: "a"},
+		{name: "two emoji", avatar: "👍👍"},
+		{name: "lone regional indicator", avatar: "🇺"},
+		{name: "leading joiner", avatar: "‍👧"},
+		{name: "empty", avatar: ""},
+		{name: "copyright", avatar: "©"},
+		{name: "registered", avatar: "®"},
+		{name: "text smiley", avatar: "☺"},
+		{name: "text heart", avatar: "❤"},
+		{name: "digit", avatar: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := ValidateAvatar(tt.avatar); got != tt.want {
+				t.Errorf("ValidateAvatar(%+q) = %v, want %v", tt.avatar, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmojiCatalogIsValid(t *testing.T) {
+	for _, category := range EmojiCatalog {
+		for _, emoji := range category.Emoji {
+			if _, ok := ValidateAvatar(emoji); !ok {
+				t.Errorf("%s: ValidateAvatar(%+q) rejected a catalog emoji", category.Slug, emoji)
+			}
+		}
+	}
+}
@@ -3,24 +3,143 @@ package helper
 import (
 	"fmt"
 	"github.com/binaryphile/lilleygram/model"
+	"github.com/rivo/uniseg"
+	"strings"
+	"unicode"
 )
 
+// GramMaxLength is the most characters, counted as user-perceived characters
+// (grapheme clusters), allowed in a gram.
+const GramMaxLength = 500
+
+// lineTypePrefixes are the gemtext line-type markers that must not begin a
+// line of a gram, lest the gram inject links, headings and the like into
+// the pages showing it.
+var lineTypePrefixes = []string{"=>", "```", "#", "*", ">"}
+
 type Gram struct {
 	ID        string
 	Avatar    string
+	Back      string
+	Edited    bool
 	Gram      string
+	Mentions  []Mention
+	Mine      bool
+	Pinned    bool
+	Replies   int
+	ReplyTo   string
+	Sparkled  bool
 	Sparkles  int
+	Tags      []Tag
+	UserID    string
 	UserName  string
+	CreatedAt string
 	UpdatedAt string
 }
 
+type GramEdit struct {
+	Gram      string
+	CreatedAt string
+}
+
+func GramEditFromModel(m model.GramEdit) GramEdit {
+	return GramEdit{
+		Gram:      m.Body,
+		CreatedAt: model.LongHumanTime(m.CreatedAt),
+	}
+}
+
 func GramFromModel(m model.Gram) Gram {
+	replyTo := ""
+
+	if m.ReplyTo.Valid {
+		replyTo = fmt.Sprintf("%d", m.ReplyTo.Int64)
+	}
+
 	return Gram{
 		ID:        fmt.Sprintf("%d", m.ID),
 		Avatar:    m.Avatar,
+		Edited:    m.Edited,
 		Gram:      m.Body,
+		Mine:      m.Mine,
+		Pinned:    m.Pinned,
+		Replies:   m.Replies,
+		ReplyTo:   replyTo,
+		Sparkled:  m.Sparkled,
 		Sparkles:  m.Sparkles,
+		UserID:    fmt.Sprintf("%d", m.UserID),
 		UserName:  m.UserName,
+		CreatedAt: model.LongHumanTime(m.CreatedAt),
 		UpdatedAt: model.HumanTime(m.UpdatedAt),
 	}
 }
+
+// GramPrompt is the input prompt for composing a gram.
+func GramPrompt() string {
+	return fmt.Sprintf("Compose your gram of up to %d characters:", GramMaxLength)
+}
+
+// GramReplyPrompt is the input prompt for replying to a user's gram.
+func GramReplyPrompt(userName string) string {
+	return fmt.Sprintf("Reply to %s in up to %d characters:", userName, GramMaxLength)
+}
+
+// GramEditPrompt is the input prompt for editing a gram.
+func GramEditPrompt() string {
+	return fmt.Sprintf("Edit your gram of up to %d characters:", GramMaxLength)
+}
+
+// SearchPrompt is the input prompt for searching grams.
+func SearchPrompt() string {
+	return "Search grams for:"
+}
+
+// ValidateGram checks that body is neither empty nor too long and returns it
+// sanitized for display in gemtext.
+func ValidateGram(body string) (_ string, err error) {
+	body = cleanText(body)
+
+	if body == "" {
+		return "", fmt.Errorf("your gram is empty")
+	}
+
+	if length := uniseg.GraphemeClusterCount(body); length > GramMaxLength {
+		return "", fmt.Errorf("your gram is %d characters, over the limit of %d", length, GramMaxLength)
+	}
+
+	return neutralizeLineTypes(body), nil
+}
+
+// cleanText normalizes line endings, drops control characters other than
+// newline and tab, and trims the result.
+func cleanText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+
+		return r
+	}, text)
+
+	return strings.TrimSpace(text)
+}
+
+// neutralizeLineTypes puts a space in front of any line of text that would
+// otherwise be read as a gemtext link, heading, list item, quote or preformat
+// toggle.
+func neutralizeLineTypes(text string) string {
+	lines := strings.Split(text, "\n")
+
+	for i, line := range lines {
+		for _, prefix := range lineTypePrefixes {
+			if strings.HasPrefix(line, prefix) {
+				lines[i] = " " + line
+				break
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
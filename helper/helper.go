@@ -3,25 +3,31 @@ package helper
 import (
 	"github.com/a-h/gemini"
 	. "github.com/binaryphile/lilleygram/controller/shortcuts"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
 	"log"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 const (
-	// Emoji regex pattern
-	avatarPattern = `^[\x{1F300}-\x{1F5FF}\x{1F600}-\x{1F64F}\x{1F680}-\x{1F6FF}\x{1F700}-\x{1F77F}\x{1F780}-\x{1F7FF}\x{1F800}-\x{1F8FF}\x{1F900}-\x{1F9FF}]$`
+	namePattern = `^\p{L}(?:[\p{L}\p{M}'’ -]*[\p{L}\p{M}])?$`
 
-	namePattern = `^[a-zA-ZÀ-ÿ][a-zA-ZÀ-ÿ' -]*[a-zA-ZÀ-ÿ]$`
+	profileFieldNamePattern = `^[\p{L}\p{N}](?:[\p{L}\p{N}' -]*[\p{L}\p{N}])?$`
 
-	userNamePattern = `^[a-zA-ZÀ-ÿ][a-zA-ZÀ-ÿ'_-]*[a-zA-ZÀ-ÿ]$`
+	pronounsPattern = `^\p{L}[\p{L} /-]*\p{L}$`
+
+	userNamePattern = `^\p{L}[\p{L}\p{M}'_-]*[\p{L}\p{M}]$`
 )
 
 var (
-	avatarRegex = regexp.MustCompile(avatarPattern)
-
 	nameRegex = regexp.MustCompile(namePattern)
 
+	profileFieldNameRegex = regexp.MustCompile(profileFieldNamePattern)
+
+	pronounsRegex = regexp.MustCompile(pronounsPattern)
+
 	userNameRegex = regexp.MustCompile(userNamePattern)
 )
 
@@ -41,32 +47,122 @@ func InternalServerError(writer ResponseWriter, err error) {
 	log.Print(err)
 }
 
+// IsYes reports whether the answer to a yes/no prompt is yes.
+func IsYes(answer string) bool {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
 func Redirect(writer ResponseWriter, location string) error {
 	return writer.SetHeader(gemini.CodeRedirect, location)
 }
 
+// ValidateAvatar checks that avatar is exactly one emoji, counted as a
+// user-perceived character (grapheme cluster).  Emoji made of several code
+// points, such as families, flags and skin tones, count as one.
 func ValidateAvatar(avatar string) (_ string, ok bool) {
 	avatar = strings.TrimSpace(avatar)
 
-	return avatar, avatarRegex.MatchString(avatar)
+	if uniseg.GraphemeClusterCount(avatar) != 1 {
+		return
+	}
+
+	return avatar, isEmoji(avatar)
 }
 
+// ValidateBio returns bio sanitized for display in gemtext, the same as a
+// gram.  An empty bio is allowed so that a bio can be cleared.
+func ValidateBio(bio string) (_ string, ok bool) {
+	bio = cleanText(bio)
+
+	if uniseg.GraphemeClusterCount(bio) > BioMaxLength {
+		return
+	}
+
+	return neutralizeLineTypes(bio), true
+}
+
+// ValidateCertificateLabel returns label on a single line without control
+// characters.
+func ValidateCertificateLabel(label string) (_ string, ok bool) {
+	label, ok = ValidateProfileFieldValue(label)
+	if !ok || uniseg.GraphemeClusterCount(label) > 30 {
+		return "", false
+	}
+
+	return label, true
+}
+
+// ValidateName returns name in NFC form with its spaces collapsed.  Names may
+// use letters from any script, and their length is counted in user-perceived
+// characters rather than bytes.
 func ValidateName(name string) (_ string, ok bool) {
-	name = strings.TrimSpace(name)
+	name = strings.Join(strings.Fields(norm.NFC.String(name)), " ")
 
-	if len(name) < 1 || len(name) > 25 {
+	if length := uniseg.GraphemeClusterCount(name); length < 1 || length > 25 {
 		return
 	}
 
 	return name, nameRegex.MatchString(name)
 }
 
+func ValidateProfileFieldName(name string) (_ string, ok bool) {
+	name = strings.Join(strings.Fields(name), " ")
+
+	if uniseg.GraphemeClusterCount(name) > 25 {
+		return
+	}
+
+	return name, profileFieldNameRegex.MatchString(name)
+}
+
+// ValidateProfileFieldValue returns value on a single line without control
+// characters.
+func ValidateProfileFieldValue(value string) (_ string, ok bool) {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+
+		return r
+	}, value)
+
+	value = strings.Join(strings.Fields(value), " ")
+
+	if length := uniseg.GraphemeClusterCount(value); length < 1 || length > 100 {
+		return
+	}
+
+	return value, true
+}
+
+// ValidatePronouns returns pronouns with their spaces collapsed.  Blank
+// pronouns are returned as "", which clears them.
+func ValidatePronouns(pronouns string) (_ string, ok bool) {
+	pronouns = strings.Join(strings.Fields(pronouns), " ")
+
+	if pronouns == "" {
+		return "", true
+	}
+
+	if uniseg.GraphemeClusterCount(pronouns) > 30 {
+		return
+	}
+
+	return pronouns, pronounsRegex.MatchString(pronouns)
+}
+
+// ValidateUserName returns name in NFC form.  Its letters may come from any
+// script, but not from a mix of scripts, so that a name can't be spelled with
+// lookalike letters from another alphabet.  See UserNameSkeleton for catching
+// lookalikes of other users' names.
 func ValidateUserName(name string) (_ string, ok bool) {
-	name = strings.TrimSpace(name)
+	name = norm.NFC.String(strings.TrimSpace(name))
 
-	if len(name) < 5 || len(name) > 50 {
+	if length := uniseg.GraphemeClusterCount(name); length < 5 || length > 50 {
 		return
 	}
 
-	return name, userNameRegex.MatchString(name)
+	return name, userNameRegex.MatchString(name) && isSingleScript(name)
 }
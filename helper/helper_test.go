@@ -0,0 +1,31 @@
+package helper
+
+import "testing"
+
+func TestValidatePronouns(t *testing.T) {
+	tests := []struct {
+		name     string
+		pronouns string
+		want     string
+		wantOK   bool
+	}{
+		{name: "slashed", pronouns: "she/her", want: "she/her", wantOK: true},
+		{name: "spaces collapsed", pronouns: " they  /  them ", want: "they / them", wantOK: true},
+		{name: "hyphenated", pronouns: "any-pronouns", want: "any-pronouns", wantOK: true},
+		{name: "blank clears", pronouns: " ", want: "", wantOK: true},
+		{name: "empty clears", pronouns: "", want: "", wantOK: true},
+		{name: "digit", pronouns: "he/him2"},
+		{name: "leading slash", pronouns: "/her"},
+		{name: "too long", pronouns: "abcdefghijklmnopqrstuvwxyzabcde"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidatePronouns(tt.pronouns)
+
+			if ok != tt.wantOK || ok && got != tt.want {
+				t.Errorf("ValidatePronouns(%+q) = %q, %v, want %q, %v", tt.pronouns, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
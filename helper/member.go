@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"fmt"
+	"github.com/binaryphile/lilleygram/model"
+)
+
+// Member is a user as shown in lists of users.  Following and Self are
+// relative to the viewer and are only set by lists that offer follow links.
+type Member struct {
+	Avatar    string
+	FirstName string
+	Following bool
+	LastName  string
+	LastSeen  string
+	Self      bool
+	UserID    string
+	UserName  string
+}
+
+func MemberFromModel(m model.User) Member {
+	return Member{
+		Avatar:    m.Avatar,
+		FirstName: m.FirstName,
+		LastName:  m.LastName,
+		LastSeen:  model.HumanTime(m.LastSeen),
+		UserID:    fmt.Sprintf("%d", m.ID),
+		UserName:  m.UserName,
+	}
+}
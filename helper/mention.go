@@ -0,0 +1,47 @@
+package helper
+
+import (
+	"fmt"
+	"github.com/binaryphile/lilleygram/model"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+)
+
+// mentionRegex matches an @username token.  The @ must not follow a letter,
+// digit or underscore, so email addresses aren't taken for mentions.
+var mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{M}\p{N}_'-]*[\p{L}\p{M}\p{N}])`)
+
+// MentionNames returns the usernames mentioned in a gram body, in order of
+// first appearance and without duplicates.  Usernames are case-insensitive,
+// so names with the same skeleton, such as @KingDad and @kingdad, are
+// duplicates.
+func MentionNames(body string) []string {
+	names := make([]string, 0)
+
+	seen := make(map[string]bool)
+
+	for _, match := range mentionRegex.FindAllStringSubmatch(body, -1) {
+		name := norm.NFC.String(match[1])
+
+		if key := UserNameSkeleton(name); !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+type Mention struct {
+	Avatar   string
+	UserID   string
+	UserName string
+}
+
+func MentionFromModel(m model.Mention) Mention {
+	return Mention{
+		Avatar:   m.Avatar,
+		UserID:   fmt.Sprintf("%d", m.UserID),
+		UserName: m.UserName,
+	}
+}
@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"fmt"
+	"github.com/binaryphile/lilleygram/model"
+)
+
+type Notification struct {
+	Avatar    string
+	Link      string
+	Text      string
+	Unread    bool
+	UserName  string
+	CreatedAt string
+}
+
+func NotificationFromModel(m model.Notification) Notification {
+	var link, text string
+
+	switch m.Kind {
+	case model.NotificationFollow:
+		link, text = fmt.Sprintf("/users/%d/profile", m.ActorID), "started following you"
+	case model.NotificationMention:
+		link, text = fmt.Sprintf("/grams/%d", m.GramID), "mentioned you in a gram"
+	case model.NotificationReply:
+		link, text = fmt.Sprintf("/grams/%d/thread", m.GramID), "replied to your gram"
+	case model.NotificationSparkle:
+		link, text = fmt.Sprintf("/grams/%d", m.GramID), "sparkled your gram"
+	default:
+		link, text = fmt.Sprintf("/users/%d/profile", m.ActorID), m.Kind
+	}
+
+	return Notification{
+		Avatar:    m.ActorAvatar,
+		Link:      link,
+		Text:      text,
+		Unread:    m.ReadAt == 0,
+		UserName:  m.ActorName,
+		CreatedAt: model.HumanTime(m.CreatedAt),
+	}
+}
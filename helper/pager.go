@@ -0,0 +1,9 @@
+package helper
+
+// Pager holds the cursors for the links to the neighboring pages of a list.
+// An empty cursor means there is no page in that direction.
+type Pager struct {
+	Newer string
+	Older string
+	Path  string
+}
@@ -0,0 +1,53 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PairingCodeLifetime is how long a pairing code can be used after it's made.
+const PairingCodeLifetime = 10 * time.Minute
+
+// pairingCodeAlphabet leaves out characters that are easily mistaken for one
+// another, such as 0 and O or 1 and I.  Its 32 characters divide a random
+// byte evenly, so each is equally likely.
+const pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewPairingCode returns a random code, such as "K7QX-M4TD", that lets a new
+// device add its certificate to the account of the user who made it.
+func NewPairingCode() (string, error) {
+	random := make([]byte, 8)
+
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, len(random))
+
+	for i, b := range random {
+		code[i] = pairingCodeAlphabet[int(b)%len(pairingCodeAlphabet)]
+	}
+
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// PairingCodeSHA256 returns the hex SHA-256 of a pairing code, which is how
+// codes are stored.  Case, spaces and hyphens are ignored, so the code can be
+// typed however is easiest.
+func PairingCodeSHA256(code string) string {
+	code = strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+
+		return unicode.ToUpper(r)
+	}, code)
+
+	hash := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -1,21 +1,105 @@
 package helper
 
+import (
+	"fmt"
+	"github.com/binaryphile/lilleygram/model"
+	"net/url"
+	"time"
+)
+
+const (
+	// BioMaxLength is the most characters, counted as grapheme clusters,
+	// allowed in a bio.
+	BioMaxLength = 300
+
+	// CertificateExpiryWarning is how long before a certificate expires that
+	// its owner is warned about it.
+	CertificateExpiryWarning = 30 * 24 * time.Hour
+
+	// LoginFailuresShown is how many of the latest failed attempts to add a
+	// certificate to an account are shown to its owner.
+	LoginFailuresShown = 10
+)
+
 type (
 	Profile struct {
-		Avatar        string
-		Certificates  []Certificate
-		FirstName     string
-		LastName      string
-		LastSeen      string
-		Me            bool
-		PasswordFound bool
-		UserID        string
-		UserName      string
-		CreatedAt     string
+		Avatar         string
+		Bio            string
+		Certificates   []Certificate
+		Fields         []ProfileField
+		FirstName      string
+		FollowerCount  int
+		Following      bool
+		FollowingCount int
+		GramCount      int
+		LastName       string
+		LastSeen       string
+		Me             bool
+		PasswordFound  bool
+		Pronouns       string
+		SparkleCount   int
+		UserID         string
+		UserName       string
+		CreatedAt      string
+	}
+
+	ProfileField struct {
+		Name  string
+		Path  string
+		Value string
 	}
 
+	// Certificate is a client certificate as its owner sees it.  Current is
+	// set for the certificate making the request.
 	Certificate struct {
-		ExpireAt  string
-		CreatedAt string
+		CreatedAt   string
+		Current     bool
+		ExpireAt    string
+		Expired     bool
+		ExpiresSoon bool
+		Fingerprint string
+		Label       string
+		LastUsed    string
+		Path        string
+		RenewByKey  bool
+	}
+
+	// LoginFailure is a failed attempt to add a certificate to an account, as
+	// the account's owner sees it.  Fingerprint is that of the certificate
+	// used.
+	LoginFailure struct {
+		CreatedAt   string
+		Fingerprint string
 	}
 )
+
+func CertificateFromModel(m model.Certificate) Certificate {
+	untilExpiry := time.Until(time.Unix(m.ExpireAt, 0))
+
+	return Certificate{
+		CreatedAt:   model.LongHumanTime(m.CreatedAt),
+		ExpireAt:    model.LongDate(m.ExpireAt),
+		Expired:     m.ExpireAt != 0 && untilExpiry <= 0,
+		ExpiresSoon: m.ExpireAt != 0 && untilExpiry > 0 && untilExpiry < CertificateExpiryWarning,
+		Fingerprint: m.SHA256,
+		Label:       m.Label,
+		LastUsed:    model.HumanTime(m.LastUsedAt),
+		Path:        fmt.Sprintf("/users/%d/certificates/%s", m.UserID, m.SHA256),
+		RenewByKey:  m.RenewByKey,
+	}
+}
+
+func LoginFailureFromModel(m model.LoginFailure) LoginFailure {
+	return LoginFailure{
+		CreatedAt:   model.LongHumanTime(m.CreatedAt),
+		Fingerprint: m.CertSHA256,
+	}
+}
+
+func ProfileFieldFromModel(m model.ProfileField) ProfileField {
+	return ProfileField{
+		Name:  m.Name,
+		Path:  fmt.Sprintf("/users/%d/fields/%s", m.UserID, url.PathEscape(m.Name)),
+		Value: m.Value,
+	}
+}
@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"github.com/binaryphile/lilleygram/model"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// tagRegex matches a #tag token of letters, digits and underscores with at
+// least one letter, so that "#1" stays a number.  The # must not follow a
+// letter, digit, underscore or &, which keeps out URL fragments and HTML
+// entities.
+var tagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+
+type Tag struct {
+	Grams int
+	Path  string
+	Tag   string
+}
+
+func TagCountFromModel(m model.TagCount) Tag {
+	return TagFromName(m.Tag, m.Grams)
+}
+
+// TagFromName makes a view tag with the path to its page.
+func TagFromName(tag string, grams int) Tag {
+	return Tag{
+		Grams: grams,
+		Path:  "/tags/" + url.PathEscape(tag),
+		Tag:   tag,
+	}
+}
+
+func TagFromModel(m model.Tag) Tag {
+	return TagFromName(m.Tag, 0)
+}
+
+// TagNames returns the lowercased tags in a gram body, in order of first
+// appearance and without duplicates.
+func TagNames(body string) []string {
+	tags := make([]string, 0)
+
+	seen := make(map[string]bool)
+
+	for _, match := range tagRegex.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
@@ -1,7 +1,12 @@
 package helper
 
+// User is the authenticated user making a request.  CertSHA256 identifies the
+// certificate the request was made with.  Unread is the number of unread
+// notifications, shown in the navigation bar.
 type User struct {
-	Avatar   string
-	UserID   uint64
-	UserName string
+	Avatar     string
+	CertSHA256 string
+	Unread     int
+	UserID     uint64
+	UserName   string
 }
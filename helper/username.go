@@ -0,0 +1,115 @@
+package helper
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// combiningGraphemeJoiner is invisible, so it is left out of skeletons along
+// with variation selectors.
+const combiningGraphemeJoiner = '\u034f'
+
+// confusables maps lowercase letters that look like a Latin letter to that
+// letter.  It covers the Cyrillic, Greek and Armenian lookalikes that matter
+// most for usernames rather than the whole of the Unicode confusables list.
+// Skeletons are lowercased first, so a letter whose capital is the lookalike,
+// such as Cyrillic в for В, maps to the Latin letter its capital resembles.
+// Since capital I can't be told apart from l in most fonts, i and l map alike.
+var confusables = map[rune]rune{
+	// Latin
+	'i': 'l', 'ı': 'l', 'ǀ': 'l', 'ɡ': 'g', 'ɑ': 'a',
+
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'l',
+	'ј': 'j', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'һ': 'h', 'ԁ': 'd', 'ѵ': 'v',
+	'ԍ': 'g',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ζ': 'z', 'η': 'h', 'ι': 'l', 'κ': 'k',
+	'μ': 'm', 'ν': 'n', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'y', 'χ': 'x',
+
+	// Armenian
+	'հ': 'h', 'ո': 'n', 'ս': 'u', 'օ': 'o', 'ց': 'g',
+}
+
+// confusableSequences are runs of Latin letters that pass for another letter.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// compatibleScripts are the sets of scripts that are commonly written together
+// and so may be mixed in a username.
+var compatibleScripts = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// UserNameSkeleton returns the form of a username used to tell whether it could
+// be mistaken for another.  Two usernames with the same skeleton look alike,
+// such as "KingDad" and "KіngDad" with a Cyrillic і, or "Ian" and "lan", or
+// differ only in case, such as "KingDad" and "KINGDAD".
+func UserNameSkeleton(userName string) string {
+	skeleton := strings.Map(func(r rune) rune {
+		if r == combiningGraphemeJoiner || unicode.Is(unicode.Variation_Selector, r) {
+			return -1
+		}
+
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+
+		return r
+	}, strings.ToLower(norm.NFKD.String(userName)))
+
+	return norm.NFC.String(confusableSequences.Replace(skeleton))
+}
+
+// isSingleScript reports whether the letters of s are from one script, or from
+// scripts that are commonly written together, such as kanji and kana.
+func isSingleScript(s string) bool {
+	scripts := make([]string, 0)
+
+	for _, r := range s {
+		name := scriptOf(r)
+
+		if name == "" || name == "Common" || name == "Inherited" || slices.Contains(scripts, name) {
+			continue
+		}
+
+		scripts = append(scripts, name)
+	}
+
+	if len(scripts) < 2 {
+		return true
+	}
+
+	for _, compatible := range compatibleScripts {
+		if isSubset(scripts, compatible) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSubset(names, of []string) bool {
+	for _, name := range names {
+		if !slices.Contains(of, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+
+	return ""
+}
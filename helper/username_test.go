@@ -0,0 +1,108 @@
+package helper
+
+import "testing"
+
+func TestUserNameSkeleton(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   string
+		wantEq bool
+	}{
+		{name: "same name", a: "KingDad", b: "KingDad", wantEq: true},
+		{name: "all capitals", a: "KingDad", b: "KINGDAD", wantEq: true},
+		{name: "all lowercase", a: "KingDad", b: "kingdad", wantEq: true},
+		{name: "capital I and lowercase i", a: "Isabella", b: "isabella", wantEq: true},
+		{name: "capital I and l", a: "Ian", b: "lan", wantEq: true},
+		{name: "lowercase i and l", a: "Ian", b: "ian", wantEq: true},
+		{name: "Cyrillic i", a: "KingDad", b: "KіngDad", wantEq: true},
+		{name: "Cyrillic capitals", a: "KingDad", b: "КingDаd", wantEq: true},
+		{name: "Cyrillic capital with distinct lowercase", a: "Bob", b: "Вob", wantEq: true},
+		{name: "whole-script Greek", a: "HOT", b: "ΗΟΤ", wantEq: true},
+		{name: "Armenian o", a: "Oscar", b: "Օscar", wantEq: true},
+		{name: "rn and m", a: "mary", b: "rnary", wantEq: true},
+		{name: "vv and w", a: "wendy", b: "vvendy", wantEq: true},
+		{name: "compatibility form", a: "Ann", b: "Ａnn", wantEq: true},
+		{name: "combining grapheme joiner", a: "KingDad", b: "King͏Dad", wantEq: true},
+		{name: "variation selector", a: "KingDad", b: "King️Dad", wantEq: true},
+		{name: "different names", a: "KingDad", b: "QueenMum"},
+		{name: "accent", a: "Jose", b: "José"},
+		{name: "different letter", a: "Grandma", b: "Grandpa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := UserNameSkeleton(tt.a), UserNameSkeleton(tt.b)
+
+			if (a == b) != tt.wantEq {
+				t.Errorf("UserNameSkeleton(%+q) = %q, UserNameSkeleton(%+q) = %q, want equal %v", tt.a, a, tt.b, b, tt.wantEq)
+			}
+		})
+	}
+}
+
+func TestValidateUserName(t *testing.T) {
+	tests := []struct {
+		name     string
+		userName string
+		want     string
+		wantOK   bool
+	}{
+		{name: "Latin", userName: "KingDad", want: "KingDad", wantOK: true},
+		{name: "trimmed", userName: "  KingDad ", want: "KingDad", wantOK: true},
+		{name: "Polish", userName: "Łukasz", want: "Łukasz", wantOK: true},
+		{name: "Greek", userName: "Ωμέγα", want: "Ωμέγα", wantOK: true},
+		{name: "Cyrillic", userName: "Наташа", want: "Наташа", wantOK: true},
+		{name: "kanji and kana", userName: "山田たろう", want: "山田たろう", wantOK: true},
+		{name: "hyphen and underscore", userName: "Anne-Marie_B", want: "Anne-Marie_B", wantOK: true},
+		{name: "decomposed accent", userName: "Jose\u0301e", want: "Jos\u00e9e", wantOK: true},
+		{name: "too short", userName: "Abcd"},
+		{name: "too long", userName: "Abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxy"},
+		{name: "mixed scripts", userName: "KіngDad"},
+		{name: "leading digit", userName: "1KingDad"},
+		{name: "trailing hyphen", userName: "KingDad-"},
+		{name: "space", userName: "King Dad"},
+		{name: "emoji", userName: "King🐱Dad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateUserName(tt.userName)
+
+			if ok != tt.wantOK || ok && got != tt.want {
+				t.Errorf("ValidateUserName(%+q) = %q, %v, want %q, %v", tt.userName, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsSingleScript(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{name: "Latin", s: "KingDad", want: true},
+		{name: "Latin with punctuation", s: "Anne-Marie_B", want: true},
+		{name: "Cyrillic", s: "Наташа", want: true},
+		{name: "Greek", s: "Ωμέγα", want: true},
+		{name: "combining marks", s: "José", want: true},
+		{name: "Japanese", s: "山田たろうタロウ", want: true},
+		{name: "Japanese with Latin", s: "Taro山田", want: true},
+		{name: "Chinese with Bopomofo", s: "王ㄅ", want: true},
+		{name: "Korean", s: "김민준", want: true},
+		{name: "Korean with Hanja", s: "金민준", want: true},
+		{name: "empty", s: "", want: true},
+		{name: "Latin and Cyrillic", s: "KіngDad"},
+		{name: "Latin and Greek", s: "Ηello"},
+		{name: "Hangul and kana", s: "민たろう"},
+		{name: "Bopomofo and kana", s: "ㄅた"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSingleScript(tt.s); got != tt.want {
+				t.Errorf("isSingleScript(%+q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"github.com/a-h/gemini"
 	"github.com/binaryphile/lilleygram/controller"
 	. "github.com/binaryphile/lilleygram/controller/shortcuts"
@@ -17,6 +18,7 @@ import (
 	"github.com/binaryphile/lilleygram/sqlrepo"
 	"github.com/doug-martin/goqu/v9"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,9 +36,24 @@ func main() {
 
 	userRepo := sqlrepo.NewUserRepo(db, unixNow)
 
-	certAuthorizer := newCertAuthorizer(userRepo)
+	// usernames chosen before lookalikes were checked, or before skeletons last
+	// changed, have no skeleton yet
+	if err := userRepo.UserNameSkeletonBackfill(helper.UserNameSkeleton); err != nil {
+		log.Fatalf("couldn't backfill username skeletons: %s", err)
+	}
+
+	notificationRepo := sqlrepo.NewNotificationRepo(db, unixNow)
+
+	certAuthorizer := newCertAuthorizer(userRepo, notificationRepo)
+
+	pageSize, err := strconv.Atoi(opt.Getenv("LGRAM_PAGE_SIZE").Or("25"))
+	if err != nil || pageSize < 1 {
+		log.Fatalf("invalid page size: %s", opt.Getenv("LGRAM_PAGE_SIZE").Or(""))
+	}
+
+	gramRepo := sqlrepo.NewGramRepo(db, unixNow)
 
-	gramController := controller.NewGramController(sqlrepo.NewGramRepo(db, unixNow))
+	gramController := controller.NewGramController(gramRepo, userRepo, uint(pageSize))
 
 	authenticatedBaseTemplates := []string{
 		"view/layout/base.tmpl",
@@ -49,10 +66,14 @@ func main() {
 	authenticatedHandler := ExtendHandler(
 		mountHandlers(map[string]Handler{
 			"/":                gramController,
+			"/discover":        gramController,
 			"/grams":           gramController,
+			"/notifications":   controller.NewNotificationController(notificationRepo, uint(pageSize)),
 			"/getting-started": handler.FileHandler(append([]string{"view/unauthenticated/getting-started.tmpl"}, authenticatedBaseTemplates...)...),
 			"/register":        handler.FileHandler(append([]string{"view/register.tmpl"}, authenticatedBaseTemplates...)...),
-			"/users":           controller.NewUserController(userRepo),
+			"/search":          gramController,
+			"/tags":            gramController,
+			"/users":           controller.NewUserController(userRepo, gramRepo, uint(pageSize)),
 		}),
 		WithRequiredAuthentication(certAuthorizer),
 	)
@@ -93,7 +114,7 @@ func main() {
 	port = ":" + opt.OfNonZero(port).Or("1965")
 
 	// Start the server
-	err := gemini.ListenAndServe(context.Background(), port, domainHandler)
+	err = gemini.ListenAndServe(context.Background(), port, domainHandler)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -124,15 +145,38 @@ func mountHandlers(handlers map[string]Handler) HandlerFunc {
 	}
 }
 
-func newCertAuthorizer(repo sqlrepo.UserRepo) FnAuthorize {
-	return func(certID, _ string) (_ helper.User, ok bool) {
+func newCertAuthorizer(repo sqlrepo.UserRepo, notificationRepo sqlrepo.NotificationRepo) FnAuthorize {
+	return func(certID, certKey string) (_ helper.User, ok bool, err error) {
 		hash := sha256.Sum256([]byte(certID))
 
 		certSHA256 := hex.EncodeToString(hash[:])
 
+		keySHA256 := helper.CertificateKeySHA256(certKey)
+
 		user, found, err := repo.GetByCertificate(certSHA256)
-		if err != nil || !found {
-			log.Print(err)
+
+		// a new certificate with the key of a registered one that its owner lets
+		// renew by key, such as a renewed certificate, takes the registered
+		// one's place
+		if err == nil && !found && keySHA256 != "" {
+			found, err = repo.CertificateRebind(keySHA256, certSHA256, helper.CertificateExpireAt(certKey))
+			if err == nil && found {
+				user, found, err = repo.GetByCertificate(certSHA256)
+			}
+		}
+
+		switch {
+		case errors.Is(err, sqlrepo.ErrCertificateExpired):
+			return helper.User{}, false, Rejection{
+				Code: gemini.CodeClientCertificateNotValid,
+				Meta: "This certificate has expired.  Create a new one and add it to your account with your password.",
+			}
+		case errors.Is(err, sqlrepo.ErrAccountExpired):
+			return helper.User{}, false, Rejection{
+				Code: gemini.CodeClientCertificateNotAuthorised,
+				Meta: "This account has expired.  Ask the capsule's administrator to renew it.",
+			}
+		case err != nil || !found:
 			return
 		}
 
@@ -141,16 +185,41 @@ func newCertAuthorizer(repo sqlrepo.UserRepo) FnAuthorize {
 			log.Print(err)
 		}
 
+		err = repo.UpdateCertificateSeen(certSHA256)
+		if err != nil {
+			log.Print(err)
+		}
+
+		// the key is only recorded once renewal by key is turned on
+		if keySHA256 != "" {
+			err = repo.CertificateBindKey(certSHA256, keySHA256)
+			if err != nil {
+				log.Print(err)
+			}
+		}
+
+		unread, err := notificationRepo.UnreadCount(user.ID)
+		if err != nil {
+			log.Print(err)
+		}
+
 		return helper.User{
-			Avatar:   user.Avatar,
-			UserID:   user.ID,
-			UserName: user.UserName,
-		}, true
+			Avatar:     user.Avatar,
+			CertSHA256: certSHA256,
+			Unread:     unread,
+			UserID:     user.ID,
+			UserName:   user.UserName,
+		}, true, nil
 	}
 }
 
+// sqliteOptions make transactions take the write lock when they begin, and
+// wait for it rather than fail when another holds it, so that transactions
+// run one at a time instead of tripping over each other.
+const sqliteOptions = "?_pragma=busy_timeout(5000)&_txlock=immediate"
+
 func openSQL(fileName string) (db *sql.DB, cleanup func()) {
-	db, err := sql.Open("sqlite", fileName)
+	db, err := sql.Open("sqlite", fileName+sqliteOptions)
 	if err != nil {
 		log.Fatalf("couldn't open sql db: %s", err)
 	}
@@ -170,7 +239,7 @@ func openSQL(fileName string) (db *sql.DB, cleanup func()) {
 		panic("flyway schema version not found")
 	}
 
-	if rank != 9 {
+	if rank != 26 {
 		panic("database out of version")
 	}
 
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"github.com/a-h/gemini"
 	"github.com/a-h/gemini/mux"
 	. "github.com/binaryphile/lilleygram/controller/shortcuts"
@@ -16,13 +17,30 @@ const (
 )
 
 type (
-	FnAuthorize = func(certID, certKey string) (helper.User, bool)
+	// FnAuthorize finds the user a certificate belongs to.  An error, such as
+	// a Rejection, stops the request rather than treating the certificate as
+	// unknown.
+	FnAuthorize = func(certID, certKey string) (_ helper.User, ok bool, err error)
+
+	FnOwner = func(id uint64) (userID uint64, found bool, err error)
 
 	Middleware = func(Handler) Handler
 
+	// Rejection is returned by an authorizer for a certificate it knows but
+	// won't accept, such as one that has expired.  Code and Meta make up the
+	// response header, so Meta should tell the user what to do about it.
+	Rejection struct {
+		Code gemini.Code
+		Meta string
+	}
+
 	contextKey string
 )
 
+func (r Rejection) Error() string {
+	return r.Meta
+}
+
 func CertUserFromRequest(r *Request) (_ helper.User, ok bool) {
 	user, ok := r.Context.Value(keyUser).(helper.User)
 	if !ok {
@@ -66,6 +84,32 @@ func EyesOnly(handler Handler) Handler {
 	})
 }
 
+// OwnerOnly restricts the handler to the user who owns the resource named by
+// the id in the path, such as the author of a gram.  Like EyesOnly, it
+// answers not found to everyone else.
+func OwnerOnly(owner FnOwner) Middleware {
+	return func(handler Handler) Handler {
+		return HandlerFunc(func(writer ResponseWriter, request *Request) {
+			user, _ := CertUserFromRequest(request)
+
+			id, _ := Uint64FromRequest(request, "id")
+
+			userID, found, err := owner(id)
+			if err != nil {
+				helper.InternalServerError(writer, err)
+				return
+			}
+
+			if !found || user.UserID != userID {
+				gemini.NotFound(writer, request)
+				return
+			}
+
+			handler.ServeGemini(writer, request)
+		})
+	}
+}
+
 func StrFromRequest(request *Request, key string) (_ string, ok bool) {
 	route, ok := mux.GetMatchedRoute(request.Context)
 	if !ok {
@@ -108,7 +152,11 @@ func WithOptionalAuthentication(authorizer FnAuthorize) Middleware {
 			certID := request.Certificate.ID
 
 			if certID != "" {
-				user, ok := authorizer(certID, request.Certificate.Key)
+				user, ok, err := authorizer(certID, request.Certificate.Key)
+				if err != nil {
+					reject(w, err)
+					return
+				}
 
 				if ok {
 					request.Context = context.WithValue(request.Context, keyUser, user)
@@ -140,7 +188,12 @@ func WithRequiredAuthentication(authorizer FnAuthorize) Middleware {
 				return
 			}
 
-			user, ok := authorizer(certID, request.Certificate.Key)
+			user, ok, err := authorizer(certID, request.Certificate.Key)
+			if err != nil {
+				reject(writer, err)
+				return
+			}
+
 			if !ok {
 				err := writer.SetHeader(gemini.CodeClientCertificateNotAuthorised, "not authorised")
 				if err != nil {
@@ -156,3 +209,18 @@ func WithRequiredAuthentication(authorizer FnAuthorize) Middleware {
 		})
 	}
 }
+
+// reject responds with the status of a Rejection, or with an internal server
+// error for any other error.
+func reject(writer ResponseWriter, err error) {
+	var rejection Rejection
+
+	if !errors.As(err, &rejection) {
+		helper.InternalServerError(writer, err)
+		return
+	}
+
+	if err := writer.SetHeader(rejection.Code, rejection.Meta); err != nil {
+		log.Print(err)
+	}
+}
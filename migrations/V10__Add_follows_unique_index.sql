@@ -0,0 +1,6 @@
+DELETE
+FROM follows
+WHERE followed_id = follower_id
+   OR id NOT IN (SELECT MIN(id) FROM follows GROUP BY followed_id, follower_id);
+
+CREATE UNIQUE INDEX follows_followed_id_follower_id ON follows (followed_id, follower_id);
@@ -0,0 +1,5 @@
+DELETE
+FROM sparkles
+WHERE id NOT IN (SELECT MIN(id) FROM sparkles GROUP BY gram_id, user_id);
+
+CREATE UNIQUE INDEX sparkles_gram_id_user_id ON sparkles (gram_id, user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE gram_edits
+(
+    id         INTEGER NOT NULL PRIMARY KEY,
+    body       TEXT    NOT NULL COLLATE NOCASE,
+    gram_id    INTEGER NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (gram_id) REFERENCES grams (id)
+);
+
+CREATE INDEX gram_edits_gram_id ON gram_edits (gram_id);
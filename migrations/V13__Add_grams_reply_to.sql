@@ -0,0 +1,3 @@
+ALTER TABLE grams ADD COLUMN reply_to INTEGER REFERENCES grams (id);
+
+CREATE INDEX grams_reply_to ON grams (reply_to);
@@ -0,0 +1,17 @@
+CREATE TABLE notifications
+(
+    id         INTEGER NOT NULL PRIMARY KEY,
+    actor_id   INTEGER NOT NULL,
+    gram_id    INTEGER NOT NULL DEFAULT 0,
+    kind       TEXT    NOT NULL,
+    read_at    INTEGER NOT NULL DEFAULT 0,
+    user_id    INTEGER NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (actor_id) REFERENCES users (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX notifications_user_id_read_at ON notifications (user_id, read_at);
+
+CREATE INDEX notifications_gram_id ON notifications (gram_id);
@@ -0,0 +1,14 @@
+CREATE TABLE mentions
+(
+    id         INTEGER NOT NULL PRIMARY KEY,
+    gram_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (gram_id) REFERENCES grams (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX mentions_gram_id_user_id ON mentions (gram_id, user_id);
+
+CREATE INDEX mentions_user_id ON mentions (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE tags
+(
+    id         INTEGER NOT NULL PRIMARY KEY,
+    gram_id    INTEGER NOT NULL,
+    tag        TEXT    NOT NULL COLLATE NOCASE,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (gram_id) REFERENCES grams (id)
+);
+
+CREATE UNIQUE INDEX tags_gram_id_tag ON tags (gram_id, tag);
+
+CREATE INDEX tags_tag ON tags (tag);
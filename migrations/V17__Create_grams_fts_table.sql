@@ -0,0 +1,30 @@
+CREATE VIRTUAL TABLE grams_fts USING fts5
+(
+    body,
+    content = 'grams',
+    content_rowid = 'id'
+);
+
+CREATE TRIGGER grams_fts_insert
+    AFTER INSERT
+    ON grams
+BEGIN
+    INSERT INTO grams_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+CREATE TRIGGER grams_fts_delete
+    AFTER DELETE
+    ON grams
+BEGIN
+    INSERT INTO grams_fts (grams_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+
+CREATE TRIGGER grams_fts_update
+    AFTER UPDATE OF body
+    ON grams
+BEGIN
+    INSERT INTO grams_fts (grams_fts, rowid, body) VALUES ('delete', old.id, old.body);
+    INSERT INTO grams_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+INSERT INTO grams_fts (grams_fts) VALUES ('rebuild');
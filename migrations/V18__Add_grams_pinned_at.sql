@@ -0,0 +1,3 @@
+ALTER TABLE grams ADD COLUMN pinned_at INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX grams_user_id_pinned_at ON grams (user_id, pinned_at);
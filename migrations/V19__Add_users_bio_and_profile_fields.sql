@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN pronouns TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE profile_fields
+(
+    id         INTEGER NOT NULL PRIMARY KEY,
+    name       TEXT    NOT NULL COLLATE NOCASE,
+    user_id    INTEGER NOT NULL,
+    value      TEXT    NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE UNIQUE INDEX profile_fields_user_id_name ON profile_fields (user_id, name);
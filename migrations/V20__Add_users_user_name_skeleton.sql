@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN user_name_skeleton TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_user_name_skeleton ON users (user_name_skeleton) WHERE user_name_skeleton != '';
@@ -0,0 +1,3 @@
+ALTER TABLE certificates ADD COLUMN label TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE certificates ADD COLUMN last_used_at INTEGER NOT NULL DEFAULT 0;
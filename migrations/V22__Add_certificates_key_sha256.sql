@@ -0,0 +1,5 @@
+ALTER TABLE certificates ADD COLUMN key_sha256 TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE certificates ADD COLUMN renew_by_key INTEGER NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX certificates_key_sha256 ON certificates (key_sha256) WHERE key_sha256 != '';
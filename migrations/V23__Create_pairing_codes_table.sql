@@ -0,0 +1,10 @@
+CREATE TABLE pairing_codes
+(
+    id          INTEGER NOT NULL PRIMARY KEY,
+    code_sha256 TEXT    NOT NULL UNIQUE,
+    expire_at   INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE login_failures
+(
+    id                 INTEGER NOT NULL PRIMARY KEY,
+    cert_sha256        TEXT    NOT NULL,
+    user_id            INTEGER NOT NULL DEFAULT 0,
+    user_name_skeleton TEXT    NOT NULL,
+    created_at         INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    updated_at         INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+);
+
+CREATE INDEX login_failures_cert_sha256 ON login_failures (cert_sha256, created_at);
+
+CREATE INDEX login_failures_user_name_skeleton ON login_failures (user_name_skeleton, created_at);
+
+CREATE INDEX login_failures_user_id ON login_failures (user_id, created_at);
@@ -0,0 +1 @@
+UPDATE users SET user_name_skeleton = '';
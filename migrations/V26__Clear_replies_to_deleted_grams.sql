@@ -0,0 +1 @@
+UPDATE grams SET reply_to = NULL WHERE reply_to IS NOT NULL AND reply_to NOT IN (SELECT id FROM grams);
@@ -1,10 +1,15 @@
 package model
 
 type Certificate struct {
-	SHA256    string `db:"cert_sha256"`
-	ExpireAt  int64  `db:"expire_at"`
-	CreatedAt int64  `db:"created_at"`
-	UpdatedAt int64  `db:"updated_at"`
+	SHA256     string `db:"cert_sha256"`
+	ExpireAt   int64  `db:"expire_at"`
+	KeySHA256  string `db:"key_sha256"`
+	Label      string `db:"label"`
+	LastUsedAt int64  `db:"last_used_at"`
+	RenewByKey bool   `db:"renew_by_key"`
+	UserID     uint64 `db:"user_id"`
+	CreatedAt  int64  `db:"created_at"`
+	UpdatedAt  int64  `db:"updated_at"`
 }
 
 func (c Certificate) GetCreatedAt() string {
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cursor marks a position in a list ordered by creation time, with the id
+// breaking ties between rows created in the same second.
+type Cursor struct {
+	CreatedAt int64
+	ID        uint64
+}
+
+func ParseCursor(s string) (_ Cursor, ok bool) {
+	strCreatedAt, strID, found := strings.Cut(s, "-")
+	if !found {
+		return
+	}
+
+	createdAt, err := strconv.ParseInt(strCreatedAt, 10, 64)
+	if err != nil {
+		return
+	}
+
+	id, err := strconv.ParseUint(strID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	return Cursor{
+		CreatedAt: createdAt,
+		ID:        id,
+	}, true
+}
+
+func (c Cursor) IsZero() bool {
+	return c == Cursor{}
+}
+
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d-%d", c.CreatedAt, c.ID)
+}
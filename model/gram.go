@@ -1,13 +1,30 @@
 package model
 
+import (
+	"database/sql"
+)
+
 type Gram struct {
-	ID        uint64 `db:"id"`
-	Avatar    string `db:"avatar"`
-	Body      string `db:"body"`
-	ExpireAt  int64  `db:"expire_at"`
-	Sparkles  int    `db:"sparkles"`
-	UserID    uint64 `db:"user_id"`
-	UserName  string `db:"user_name"`
-	CreatedAt int64  `db:"created_at"`
-	UpdatedAt int64  `db:"updated_at"`
+	ID        uint64        `db:"id"`
+	Avatar    string        `db:"avatar"`
+	Body      string        `db:"body"`
+	Edited    bool          `db:"edited"`
+	ExpireAt  int64         `db:"expire_at"`
+	Mine      bool          `db:"mine"`
+	Pinned    bool          `db:"pinned"`
+	Replies   int           `db:"replies"`
+	ReplyTo   sql.NullInt64 `db:"reply_to"`
+	Sparkled  bool          `db:"sparkled"`
+	Sparkles  int           `db:"sparkles"`
+	UserID    uint64        `db:"user_id"`
+	UserName  string        `db:"user_name"`
+	CreatedAt int64         `db:"created_at"`
+	UpdatedAt int64         `db:"updated_at"`
+}
+
+func (g Gram) Cursor() Cursor {
+	return Cursor{
+		CreatedAt: g.CreatedAt,
+		ID:        g.ID,
+	}
 }
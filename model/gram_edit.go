@@ -0,0 +1,11 @@
+package model
+
+// GramEdit holds the body a gram had before an edit.  CreatedAt is the time
+// of the edit that replaced it.
+type GramEdit struct {
+	ID        uint64 `db:"id"`
+	Body      string `db:"body"`
+	GramID    uint64 `db:"gram_id"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
@@ -67,3 +67,13 @@ func LongHumanTime(unixTime int64) string {
 
 	return human
 }
+
+// LongDate returns just the date of unixTime.  Unlike LongHumanTime, it suits
+// times in the future, such as expiry dates.
+func LongDate(unixTime int64) string {
+	if unixTime == 0 {
+		return ""
+	}
+
+	return time.Unix(unixTime, 0).Format("02 Jan 2006")
+}
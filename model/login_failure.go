@@ -0,0 +1,10 @@
+package model
+
+// LoginFailure is a failed attempt to add a certificate to an account with a
+// password.  UserID is 0 when no account has the username tried.
+type LoginFailure struct {
+	ID         uint64 `db:"id"`
+	CertSHA256 string `db:"cert_sha256"`
+	UserID     uint64 `db:"user_id"`
+	CreatedAt  int64  `db:"created_at"`
+}
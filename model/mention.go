@@ -0,0 +1,13 @@
+package model
+
+// Mention records that a gram mentions a user by name.  Avatar and UserName
+// belong to the mentioned user.
+type Mention struct {
+	ID        uint64 `db:"id"`
+	Avatar    string `db:"avatar"`
+	GramID    uint64 `db:"gram_id"`
+	UserID    uint64 `db:"user_id"`
+	UserName  string `db:"user_name"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package model
+
+const (
+	NotificationFollow  = "follow"
+	NotificationMention = "mention"
+	NotificationReply   = "reply"
+	NotificationSparkle = "sparkle"
+)
+
+// Notification tells a user that an actor did something involving them.
+// GramID is zero for notifications that don't concern a gram.
+type Notification struct {
+	ID          uint64 `db:"id"`
+	ActorAvatar string `db:"actor_avatar"`
+	ActorID     uint64 `db:"actor_id"`
+	ActorName   string `db:"actor_name"`
+	GramID      uint64 `db:"gram_id"`
+	Kind        string `db:"kind"`
+	ReadAt      int64  `db:"read_at"`
+	UserID      uint64 `db:"user_id"`
+	CreatedAt   int64  `db:"created_at"`
+	UpdatedAt   int64  `db:"updated_at"`
+}
+
+func (n Notification) Cursor() Cursor {
+	return Cursor{
+		CreatedAt: n.CreatedAt,
+		ID:        n.ID,
+	}
+}
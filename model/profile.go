@@ -7,12 +7,25 @@ import (
 type (
 	Profile struct {
 		Avatar    string         `db:"users.avatar"`
+		Bio       string         `db:"users.bio"`
 		FirstName string         `db:"users.first_name"`
 		LastName  string         `db:"users.last_name"`
 		LastSeen  int64          `db:"users.last_seen"`
 		Password  sql.NullString `db:"passwords.argon2"`
+		Pronouns  string         `db:"users.pronouns"`
 		UserID    uint64         `db:"users.id"`
 		UserName  string         `db:"users.user_name"`
 		CreatedAt int64          `db:"users.created_at"`
 	}
+
+	// ProfileField is a user-defined detail shown on a profile, such as
+	// "Favorite food".
+	ProfileField struct {
+		ID        uint64 `db:"id"`
+		Name      string `db:"name"`
+		UserID    uint64 `db:"user_id"`
+		Value     string `db:"value"`
+		CreatedAt int64  `db:"created_at"`
+		UpdatedAt int64  `db:"updated_at"`
+	}
 )
@@ -0,0 +1,17 @@
+package model
+
+// Tag records that a gram carries a hashtag.  Tags are stored lowercase and
+// without the leading #.
+type Tag struct {
+	ID        uint64 `db:"id"`
+	GramID    uint64 `db:"gram_id"`
+	Tag       string `db:"tag"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+// TagCount is a tag along with the number of grams carrying it.
+type TagCount struct {
+	Grams int    `db:"grams"`
+	Tag   string `db:"tag"`
+}
@@ -1,9 +1,13 @@
 package sqlrepo
 
 import (
+	"errors"
+	"fmt"
 	"github.com/binaryphile/lilleygram/model"
 	. "github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"strings"
+	"unicode"
 )
 
 type (
@@ -16,8 +20,64 @@ type (
 	Fromer interface {
 		From(...any) *SelectDataset
 	}
+
+	Updater interface {
+		Update(any) *UpdateDataset
+	}
+)
+
+const (
+	// maxPins is how many grams a user may pin to their profile.
+	maxPins = 3
+
+	// maxThreadDepth bounds how far up a thread AncestorList will climb.
+	maxThreadDepth = 100
 )
 
+var (
+	ErrPinLimit = fmt.Errorf("users may pin no more than %d grams", maxPins)
+)
+
+// gramTables are the tables holding rows that belong to a gram, keyed by
+// their gram id column.  They are cleared when the gram is deleted.
+var gramTables = map[string]string{
+	"gram_edits":    "gram_id",
+	"mentions":      "gram_id",
+	"notifications": "gram_id",
+	"sparkles":      "gram_id",
+	"tags":          "gram_id",
+}
+
+// gramColumns selects a model.Gram from grams g joined to users u and left
+// joined to sparkles s.  Mine and Sparkled are relative to the viewer.
+func gramColumns(viewerID uint64) []any {
+	edits := From("gram_edits").
+		Select(L("1")).
+		Where(Ex{"gram_id": I("g.id")})
+
+	replies := From("grams").
+		Select(COUNT("*")).
+		Where(Ex{"reply_to": I("g.id")})
+
+	return []any{
+		"g.id",
+		"g.user_id",
+		"u.user_name",
+		"u.avatar",
+		"g.body",
+		L("EXISTS ?", edits).As("edited"),
+		Case().When(Ex{"g.user_id": viewerID}, 1).Else(0).As("mine"),
+		L("g.pinned_at > 0").As("pinned"),
+		L("(?)", replies).As("replies"),
+		"g.reply_to",
+		COUNT(I("s.id")).As("sparkles"),
+		MAX(Case().When(Ex{"s.user_id": viewerID}, 1).Else(0)).As("sparkled"),
+		"g.expire_at",
+		"g.created_at",
+		"g.updated_at",
+	}
+}
+
 func NewGramRepo(db *Database, now fnTime) GramRepo {
 	return GramRepo{
 		db:  db,
@@ -25,32 +85,310 @@ func NewGramRepo(db *Database, now fnTime) GramRepo {
 	}
 }
 
-func (r GramRepo) Add(userID uint64, body string) (_ uint64, err error) {
-	db := ifThenElse[Inserter](r.tx != nil, r.tx, r.db)
+// Add adds a gram with its tags and records the users it mentions, notifying
+// them.
+func (r GramRepo) Add(userID uint64, body string, mentionIDs []uint64, tags []string) (gramID uint64, err error) {
+	err = r.inTx(func(tx GramRepo) error {
+		query := tx.tx.
+			Insert("grams").
+			Rows(
+				Record{"user_id": userID, "body": body},
+			)
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		gramID = uint64(id)
+
+		err = tx.mention(gramID, userID, mentionIDs)
+		if err != nil {
+			return err
+		}
+
+		return tx.tag(gramID, tags)
+	})
+
+	return
+}
+
+// AddReply adds a gram in reply to another and notifies the other's author
+// as well as the users it mentions.
+func (r GramRepo) AddReply(userID, replyTo uint64, body string, mentionIDs []uint64, tags []string) (gramID uint64, err error) {
+	err = r.inTx(func(tx GramRepo) error {
+		parentUserID, found, err := tx.GetUserID(replyTo)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return errors.New("replied-to gram not found")
+		}
+
+		query := tx.tx.
+			Insert("grams").
+			Rows(
+				Record{"user_id": userID, "body": body, "reply_to": replyTo},
+			)
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		gramID = uint64(id)
+
+		err = notify(tx.tx, parentUserID, userID, model.NotificationReply, gramID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.mention(gramID, userID, mentionIDs)
+		if err != nil {
+			return err
+		}
+
+		return tx.tag(gramID, tags)
+	})
+
+	return
+}
+
+// AncestorList returns the chain of grams that the gram replies to, starting
+// from the one that began the thread.
+func (r GramRepo) AncestorList(gramID, viewerID uint64) (_ []model.Gram, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0)
+
+	parent := db.
+		From("grams").
+		Select(I("reply_to").As("id"), L("1").As("depth")).
+		Where(Ex{"id": gramID})
+
+	grandparent := db.
+		From(T("grams").As("p")).
+		Join(T("ancestors").As("a"), On(Ex{"p.id": I("a.id")})).
+		Select(I("p.reply_to"), L("a.depth + 1")).
+		Where(I("p.reply_to").IsNotNull(), I("a.depth").Lt(maxThreadDepth))
 
 	query := db.
-		Insert("grams").
-		Rows(
-			Record{"user_id": userID, "body": body},
-		)
+		From(T("ancestors").As("a")).
+		WithRecursive("ancestors(id, depth)", parent.UnionAll(grandparent)).
+		Join(T("grams").As("g"), On(Ex{"a.id": I("g.id")})).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		GroupBy(I("g.id")).
+		Order(MAX(I("a.depth")).Desc())
 
-	result, err := query.Executor().Exec()
-	if err != nil {
+	if err = query.ScanStructs(&grams); err != nil {
 		return
 	}
 
-	gramID, err := result.LastInsertId()
+	return grams, nil
+}
+
+// Delete deletes a gram along with the rows that belong to it.  Replies to it
+// are kept but no longer say what they replied to, so that they don't link to
+// a gram that isn't there.
+func (r GramRepo) Delete(gramID uint64) error {
+	return r.inTx(func(tx GramRepo) error {
+		replies := tx.tx.
+			Update("grams").
+			Where(Ex{"reply_to": gramID}).
+			Set(Record{"reply_to": nil})
+
+		if _, err := replies.Executor().Exec(); err != nil {
+			return err
+		}
+
+		for table, column := range gramTables {
+			query := tx.tx.
+				Delete(table).
+				Where(Ex{column: gramID})
+
+			if _, err := query.Executor().Exec(); err != nil {
+				return err
+			}
+		}
+
+		query := tx.tx.
+			Delete("grams").
+			Where(Ex{"id": gramID})
+
+		_, err := query.Executor().Exec()
+
+		return err
+	})
+}
+
+func (r GramRepo) Discover(viewerID uint64, page Page) (_ []model.Gram, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, page.Limit+1)
+
+	query := db.
+		From(T("grams").As("g")).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		GroupBy(I("g.id"))
+
+	err = paginate(query, page, "g.created_at", "g.id").ScanStructs(&grams)
 	if err != nil {
 		return
 	}
 
-	return uint64(gramID), nil
+	grams, more = pageOf(grams, page)
+
+	return grams, more, nil
 }
 
-func (r GramRepo) List(userID uint64) (_ []model.Gram, err error) {
+// Edit replaces the body of a gram, keeping the old body in its edit history.
+// Mentions and tags are replaced as well; only users newly mentioned are
+// notified.
+func (r GramRepo) Edit(gramID uint64, body string, mentionIDs []uint64, tags []string) error {
+	return r.inTx(func(tx GramRepo) error {
+		previous := From("grams").
+			Select("body", "id").
+			Where(Ex{"id": gramID})
+
+		insert := tx.tx.
+			Insert("gram_edits").
+			Cols("body", "gram_id").
+			FromQuery(previous)
+
+		if _, err := insert.Executor().Exec(); err != nil {
+			return err
+		}
+
+		update := tx.tx.
+			Update("grams").
+			Where(Ex{"id": gramID}).
+			Set(
+				Record{"body": body, "updated_at": tx.now()},
+			)
+
+		result, err := update.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return errors.New("no rows affected")
+		}
+
+		unmentioned := tx.tx.
+			Delete("mentions").
+			Where(
+				Ex{"gram_id": gramID},
+				C("user_id").NotIn(mentionIDs),
+			)
+
+		if _, err = unmentioned.Executor().Exec(); err != nil {
+			return err
+		}
+
+		untagged := tx.tx.
+			Delete("tags").
+			Where(
+				Ex{"gram_id": gramID},
+				C("tag").NotIn(tags),
+			)
+
+		if _, err = untagged.Executor().Exec(); err != nil {
+			return err
+		}
+
+		authorID, _, err := tx.GetUserID(gramID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.mention(gramID, authorID, mentionIDs)
+		if err != nil {
+			return err
+		}
+
+		return tx.tag(gramID, tags)
+	})
+}
+
+func (r GramRepo) EditList(gramID uint64) (_ []model.GramEdit, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	edits := make([]model.GramEdit, 0)
+
+	query := db.
+		From("gram_edits").
+		Where(Ex{"gram_id": gramID}).
+		Order(I("created_at").Desc(), I("id").Desc())
+
+	if err = query.ScanStructs(&edits); err != nil {
+		return
+	}
+
+	return edits, nil
+}
+
+func (r GramRepo) Get(gramID, viewerID uint64) (_ model.Gram, found bool, err error) {
 	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
 
-	grams := make([]model.Gram, 0, 25)
+	var gram model.Gram
+
+	query := db.
+		From(T("grams").As("g")).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		Where(Ex{"g.id": gramID}).
+		GroupBy(I("g.id"))
+
+	if found, err = query.ScanStruct(&gram); err != nil || !found {
+		return
+	}
+
+	return gram, true, nil
+}
+
+func (r GramRepo) GetUserID(gramID uint64) (_ uint64, found bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	var userID uint64
+
+	query := db.
+		From("grams").
+		Select("user_id").
+		Where(Ex{"id": gramID})
+
+	if found, err = query.ScanVal(&userID); err != nil || !found {
+		return
+	}
+
+	return userID, true, nil
+}
+
+func (r GramRepo) List(userID uint64, page Page) (_ []model.Gram, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, page.Limit+1)
 
 	// Define the subquery for users you follow
 	followedUsers := db.
@@ -73,8 +411,9 @@ func (r GramRepo) List(userID uint64) (_ []model.Gram, err error) {
 		Select("gram_id").
 		Where(Ex{"user_id": followedUsers})
 
-	// Union the two queries
-	unioned := gramsQuery.UnionAll(sparklesQuery)
+	// Union the two queries, dropping duplicates so sparkles aren't counted
+	// once for each way a gram made it onto the timeline
+	unioned := gramsQuery.Union(sparklesQuery)
 
 	// Begin constructing the main query using the updated table names
 	query := db.
@@ -83,48 +422,380 @@ func (r GramRepo) List(userID uint64) (_ []model.Gram, err error) {
 		Join(T("grams").As("g"), On(Ex{"cg.id": I("g.id")})).
 		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
 		LeftJoin(T("sparkles").As("s"), On(Ex{"cg.id": I("s.gram_id")})).
-		Select(
-			"g.id",
-			"g.user_id",
-			"u.user_name",
-			"u.avatar",
-			"g.body",
-			COUNT(I("s.id")).As("sparkles"),
-			"g.expire_at",
-			"g.created_at",
-			"g.updated_at",
-		).
-		GroupBy(I("cg.id")).
-		Order(I("g.created_at").Desc())
+		Select(gramColumns(userID)...).
+		GroupBy(I("cg.id"))
 
-	err = query.ScanStructs(&grams)
+	err = paginate(query, page, "g.created_at", "g.id").ScanStructs(&grams)
 	if err != nil {
 		return
 	}
 
-	return grams, nil
+	grams, more = pageOf(grams, page)
+
+	return grams, more, nil
 }
 
-func (r GramRepo) Sparkle(gramID, userID uint64) (_ uint64, err error) {
-	db := ifThenElse[Inserter](r.tx != nil, r.tx, r.db)
+// ListByTag returns the grams carrying a tag, newest first.
+func (r GramRepo) ListByTag(tag string, viewerID uint64, page Page) (_ []model.Gram, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, page.Limit+1)
 
 	query := db.
-		Insert("sparkles").
-		Rows(
-			Record{"gram_id": gramID, "user_id": userID},
-		)
+		From(T("grams").As("g")).
+		Join(T("tags").As("t"), On(Ex{"g.id": I("t.gram_id")})).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		Where(Ex{"t.tag": tag}).
+		GroupBy(I("g.id"))
 
-	result, err := query.Executor().Exec()
+	err = paginate(query, page, "g.created_at", "g.id").ScanStructs(&grams)
 	if err != nil {
 		return
 	}
 
-	sparkleID, err := result.LastInsertId()
+	grams, more = pageOf(grams, page)
+
+	return grams, more, nil
+}
+
+// ListByUser returns the grams a user posted, newest first.
+func (r GramRepo) ListByUser(userID, viewerID uint64, page Page) (_ []model.Gram, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, page.Limit+1)
+
+	query := db.
+		From(T("grams").As("g")).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		Where(Ex{"g.user_id": userID}).
+		GroupBy(I("g.id"))
+
+	err = paginate(query, page, "g.created_at", "g.id").ScanStructs(&grams)
 	if err != nil {
 		return
 	}
 
-	return uint64(sparkleID), nil
+	grams, more = pageOf(grams, page)
+
+	return grams, more, nil
+}
+
+// MentionList returns the users mentioned by each of the given grams.
+func (r GramRepo) MentionList(gramIDs []uint64) (_ []model.Mention, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	mentions := make([]model.Mention, 0)
+
+	if len(gramIDs) == 0 {
+		return mentions, nil
+	}
+
+	query := db.
+		From(T("mentions").As("m")).
+		Join(T("users").As("u"), On(Ex{"m.user_id": I("u.id")})).
+		Select("m.id", "u.avatar", "m.gram_id", "m.user_id", "u.user_name", "m.created_at", "m.updated_at").
+		Where(Ex{"m.gram_id": gramIDs}).
+		Order(I("m.id").Asc())
+
+	if err = query.ScanStructs(&mentions); err != nil {
+		return
+	}
+
+	return mentions, nil
+}
+
+// Pin pins a gram to its author's profile, unless they have pinned as many as
+// they may already.  Pinning a pinned gram does nothing.
+func (r GramRepo) Pin(gramID uint64) error {
+	return r.inTx(func(tx GramRepo) error {
+		userID, found, err := tx.GetUserID(gramID)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return errors.New("gram not found")
+		}
+
+		var pins int
+
+		query := tx.tx.
+			From("grams").
+			Select(COUNT("*")).
+			Where(Ex{"user_id": userID}, C("pinned_at").Gt(0), C("id").Neq(gramID))
+
+		if _, err = query.ScanVal(&pins); err != nil {
+			return err
+		}
+
+		if pins >= maxPins {
+			return ErrPinLimit
+		}
+
+		update := tx.tx.
+			Update("grams").
+			Where(Ex{"id": gramID, "pinned_at": 0}).
+			Set(
+				Record{"pinned_at": tx.now()},
+			)
+
+		_, err = update.Executor().Exec()
+
+		return err
+	})
+}
+
+// PinList returns the grams a user has pinned, most recently pinned first.
+func (r GramRepo) PinList(userID, viewerID uint64) (_ []model.Gram, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, maxPins)
+
+	query := db.
+		From(T("grams").As("g")).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		Where(Ex{"g.user_id": userID}, I("g.pinned_at").Gt(0)).
+		GroupBy(I("g.id")).
+		Order(I("g.pinned_at").Desc(), I("g.id").Desc())
+
+	if err = query.ScanStructs(&grams); err != nil {
+		return
+	}
+
+	return grams, nil
+}
+
+// ReplyList returns the direct replies to a gram, oldest first.
+func (r GramRepo) ReplyList(gramID, viewerID uint64) (_ []model.Gram, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0)
+
+	query := db.
+		From(T("grams").As("g")).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		Where(Ex{"g.reply_to": gramID}).
+		GroupBy(I("g.id")).
+		Order(I("g.created_at").Asc(), I("g.id").Asc())
+
+	if err = query.ScanStructs(&grams); err != nil {
+		return
+	}
+
+	return grams, nil
+}
+
+// Search returns the grams matching every word of text, best matches first.
+// Every member's grams are searched, the same as Discover shows.  Search
+// pages by offset rather than cursor since results aren't in time order.
+func (r GramRepo) Search(text string, viewerID uint64, offset, limit uint) (_ []model.Gram, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	grams := make([]model.Gram, 0, limit+1)
+
+	match := ftsQuery(text)
+	if match == "" {
+		return grams, false, nil
+	}
+
+	matches := db.
+		From("grams_fts").
+		Select(I("rowid").As("id"), I("rank")).
+		Where(L("grams_fts MATCH ?", match))
+
+	query := db.
+		From(T("matches").As("m")).
+		With("matches", matches).
+		Join(T("grams").As("g"), On(Ex{"m.id": I("g.id")})).
+		Join(T("users").As("u"), On(Ex{"g.user_id": I("u.id")})).
+		LeftJoin(T("sparkles").As("s"), On(Ex{"g.id": I("s.gram_id")})).
+		Select(gramColumns(viewerID)...).
+		GroupBy(I("g.id")).
+		Order(MIN(I("m.rank")).Asc(), I("g.created_at").Desc(), I("g.id").Desc()).
+		Offset(offset).
+		Limit(limit + 1)
+
+	if err = query.ScanStructs(&grams); err != nil {
+		return
+	}
+
+	if more = uint(len(grams)) > limit; more {
+		grams = grams[:limit]
+	}
+
+	return grams, more, nil
+}
+
+// Sparkle records that a user sparkled a gram and notifies its author.  found
+// is false if there is no such gram.
+func (r GramRepo) Sparkle(gramID, userID uint64) (found bool, err error) {
+	err = r.inTx(func(tx GramRepo) error {
+		authorID, ok, err := tx.GetUserID(gramID)
+		if err != nil || !ok {
+			return err
+		}
+
+		found = true
+
+		query := tx.tx.
+			Insert("sparkles").
+			Rows(
+				Record{"gram_id": gramID, "user_id": userID},
+			).
+			OnConflict(DoNothing())
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+
+		return notify(tx.tx, authorID, userID, model.NotificationSparkle, gramID)
+	})
+
+	return found, err
+}
+
+func (r GramRepo) SparklerList(gramID uint64) (_ []model.User, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	users := make([]model.User, 0)
+
+	query := db.
+		From("users").
+		Join(
+			T("sparkles"), On(Ex{"users.id": I("sparkles.user_id")}),
+		).
+		Where(Ex{"sparkles.gram_id": gramID}).
+		GroupBy(I("users.id")).
+		Order(MIN(I("sparkles.created_at")).Asc())
+
+	if err = query.ScanStructs(&users); err != nil {
+		return
+	}
+
+	return users, nil
+}
+
+// TagCountList returns every tag with the number of grams carrying it, most
+// used first.
+func (r GramRepo) TagCountList() (_ []model.TagCount, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	counts := make([]model.TagCount, 0)
+
+	query := db.
+		From("tags").
+		Select(COUNT("*").As("grams"), "tag").
+		GroupBy("tag").
+		Order(I("grams").Desc(), I("tag").Asc())
+
+	if err = query.ScanStructs(&counts); err != nil {
+		return
+	}
+
+	return counts, nil
+}
+
+// TagList returns the tags carried by each of the given grams.
+func (r GramRepo) TagList(gramIDs []uint64) (_ []model.Tag, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	tags := make([]model.Tag, 0)
+
+	if len(gramIDs) == 0 {
+		return tags, nil
+	}
+
+	query := db.
+		From("tags").
+		Where(Ex{"gram_id": gramIDs}).
+		Order(I("id").Asc())
+
+	if err = query.ScanStructs(&tags); err != nil {
+		return
+	}
+
+	return tags, nil
+}
+
+// UserCounts returns how many grams a user has posted and how many sparkles
+// others have given them.
+func (r GramRepo) UserCounts(userID uint64) (grams, sparkles int, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	posted := db.
+		From("grams").
+		Select(COUNT("*")).
+		Where(Ex{"user_id": userID})
+
+	if _, err = posted.ScanVal(&grams); err != nil {
+		return
+	}
+
+	received := db.
+		From(T("sparkles").As("s")).
+		Join(T("grams").As("g"), On(Ex{"s.gram_id": I("g.id")})).
+		Select(COUNT("*")).
+		Where(Ex{"g.user_id": userID}, I("s.user_id").Neq(userID))
+
+	if _, err = received.ScanVal(&sparkles); err != nil {
+		return
+	}
+
+	return grams, sparkles, nil
+}
+
+func (r GramRepo) Unpin(gramID uint64) error {
+	db := ifThenElse[Updater](r.tx != nil, r.tx, r.db)
+
+	query := db.
+		Update("grams").
+		Where(Ex{"id": gramID}).
+		Set(
+			Record{"pinned_at": 0},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// Unsparkle takes back a user's sparkle of a gram.  found is false if there is
+// no such gram.
+func (r GramRepo) Unsparkle(gramID, userID uint64) (found bool, err error) {
+	err = r.inTx(func(tx GramRepo) error {
+		authorID, ok, err := tx.GetUserID(gramID)
+		if err != nil || !ok {
+			return err
+		}
+
+		found = true
+
+		query := tx.tx.
+			Delete("sparkles").
+			Where(Ex{"gram_id": gramID, "user_id": userID})
+
+		if _, err := query.Executor().Exec(); err != nil {
+			return err
+		}
+
+		return unnotify(tx.tx, authorID, userID, model.NotificationSparkle, gramID)
+	})
+
+	return found, err
 }
 
 // WithTx starts a new transaction and executes it in Wrap method
@@ -146,3 +817,79 @@ func (r GramRepo) WithTx(fn func(GramRepo) error) error {
 		},
 	)
 }
+
+// inTx runs fn in the current transaction, or in a new one if there is none.
+func (r GramRepo) inTx(fn func(GramRepo) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	return r.WithTx(fn)
+}
+
+// mention records that the gram mentions the users and notifies those not
+// already mentioned by it.  It must be called in a transaction.
+func (r GramRepo) mention(gramID, actorID uint64, userIDs []uint64) error {
+	for _, userID := range userIDs {
+		query := r.tx.
+			Insert("mentions").
+			Rows(
+				Record{"gram_id": gramID, "user_id": userID},
+			).
+			OnConflict(DoNothing())
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			continue
+		}
+
+		err = notify(r.tx, userID, actorID, model.NotificationMention, gramID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tag records that the gram carries the tags.  It must be called in a
+// transaction.
+func (r GramRepo) tag(gramID uint64, tags []string) error {
+	for _, tag := range tags {
+		query := r.tx.
+			Insert("tags").
+			Rows(
+				Record{"gram_id": gramID, "tag": tag},
+			).
+			OnConflict(DoNothing())
+
+		if _, err := query.Executor().Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ftsQuery makes an FTS5 query matching every word of text.  Each word is
+// quoted so that punctuation in text can't be taken for query syntax.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,117 @@
+package sqlrepo
+
+import (
+	"github.com/binaryphile/lilleygram/model"
+	. "github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+)
+
+type (
+	NotificationRepo struct {
+		db  *Database
+		now func() int64
+		tx  *TxDatabase
+	}
+)
+
+func NewNotificationRepo(db *Database, now fnTime) NotificationRepo {
+	return NotificationRepo{
+		db:  db,
+		now: now,
+	}
+}
+
+func (r NotificationRepo) List(userID uint64, page Page) (_ []model.Notification, more bool, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	notifications := make([]model.Notification, 0, page.Limit+1)
+
+	query := db.
+		From(T("notifications").As("n")).
+		Join(T("users").As("u"), On(Ex{"n.actor_id": I("u.id")})).
+		Select(
+			"n.id",
+			I("u.avatar").As("actor_avatar"),
+			"n.actor_id",
+			I("u.user_name").As("actor_name"),
+			"n.gram_id",
+			"n.kind",
+			"n.read_at",
+			"n.user_id",
+			"n.created_at",
+			"n.updated_at",
+		).
+		Where(Ex{"n.user_id": userID})
+
+	err = paginate(query, page, "n.created_at", "n.id").ScanStructs(&notifications)
+	if err != nil {
+		return
+	}
+
+	notifications, more = pageOf(notifications, page)
+
+	return notifications, more, nil
+}
+
+func (r NotificationRepo) MarkRead(userID uint64, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := r.db.
+		Update("notifications").
+		Where(Ex{"user_id": userID, "id": ids, "read_at": 0}).
+		Set(
+			Record{"read_at": r.now(), "updated_at": r.now()},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+func (r NotificationRepo) UnreadCount(userID uint64) (_ int, err error) {
+	var count int
+
+	query := r.db.
+		From("notifications").
+		Select(COUNT("*")).
+		Where(Ex{"user_id": userID, "read_at": 0})
+
+	if _, err = query.ScanVal(&count); err != nil {
+		return
+	}
+
+	return count, nil
+}
+
+// notify records a notification for userID unless the actor is that user.
+// The other repos call it from inside the transactions that make the
+// changes worth notifying about.
+func notify(db Inserter, userID, actorID uint64, kind string, gramID uint64) error {
+	if userID == actorID {
+		return nil
+	}
+
+	query := db.
+		Insert("notifications").
+		Rows(
+			Record{"actor_id": actorID, "gram_id": gramID, "kind": kind, "user_id": userID},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// unnotify withdraws the notifications an actor caused of the given kind,
+// such as when a sparkle is taken back.
+func unnotify(db *TxDatabase, userID, actorID uint64, kind string, gramID uint64) error {
+	query := db.
+		Delete("notifications").
+		Where(Ex{"actor_id": actorID, "gram_id": gramID, "kind": kind, "user_id": userID})
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
@@ -0,0 +1,61 @@
+package sqlrepo
+
+import (
+	"github.com/binaryphile/lilleygram/model"
+	. "github.com/doug-martin/goqu/v9"
+	"slices"
+)
+
+// Page selects up to Limit rows on one side of Cursor.  Pages run from newest
+// to oldest unless Newer is set, in which case they run toward the newest
+// rows.  A zero Cursor starts from the newest row.
+type Page struct {
+	Cursor model.Cursor
+	Limit  uint
+	Newer  bool
+}
+
+// paginate restricts query to the page, ordering on the given created_at and
+// id columns.  It asks for one row more than the limit so that pageOf can
+// tell whether another page follows.
+func paginate(query *SelectDataset, page Page, createdAt, id string) *SelectDataset {
+	c := page.Cursor
+
+	if page.Newer {
+		if !c.IsZero() {
+			query = query.Where(
+				Or(
+					I(createdAt).Gt(c.CreatedAt),
+					And(I(createdAt).Eq(c.CreatedAt), I(id).Gt(c.ID)),
+				),
+			)
+		}
+
+		return query.Order(I(createdAt).Asc(), I(id).Asc()).Limit(page.Limit + 1)
+	}
+
+	if !c.IsZero() {
+		query = query.Where(
+			Or(
+				I(createdAt).Lt(c.CreatedAt),
+				And(I(createdAt).Eq(c.CreatedAt), I(id).Lt(c.ID)),
+			),
+		)
+	}
+
+	return query.Order(I(createdAt).Desc(), I(id).Desc()).Limit(page.Limit + 1)
+}
+
+// pageOf trims the extra row fetched by paginate and puts the rows in
+// newest-first order.
+func pageOf[T any](rows []T, page Page) (_ []T, more bool) {
+	if uint(len(rows)) > page.Limit {
+		rows, more = rows[:page.Limit], true
+	}
+
+	if page.Newer {
+		slices.Reverse(rows)
+	}
+
+	return rows, more
+}
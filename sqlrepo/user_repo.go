@@ -1,10 +1,53 @@
 package sqlrepo
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/binaryphile/lilleygram/model"
 	. "github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"time"
+)
+
+const (
+	// loginBackoff is how many seconds a client or username must wait after
+	// its free failed sign-in attempts are used up.  The wait doubles with
+	// each further failure, up to loginBackoffMax.
+	loginBackoff    = 30
+	loginBackoffMax = 60 * 60
+
+	// loginFailureWindow is how many seconds a failed sign-in attempt counts
+	// toward backing off.
+	loginFailureWindow = 24 * 60 * 60
+
+	// loginFreeFailures is how many failed sign-in attempts are allowed before
+	// backing off.
+	loginFreeFailures = 3
+
+	// maxProfileFields is how many custom fields a user may add to their
+	// profile.
+	maxProfileFields = 5
+)
+
+var (
+	ErrAccountExpired = errors.New("account has expired")
+
+	ErrCertificateExpired = errors.New("certificate has expired")
+
+	ErrLastCertificate = errors.New("users may not revoke their only certificate")
+
+	ErrProfileFieldLimit = fmt.Errorf("users may add no more than %d profile fields", maxProfileFields)
+
+	ErrSelfFollow = errors.New("users may not follow themselves")
+
+	ErrUserNameTaken = errors.New("username is taken or looks like one that is")
+
+	// errLoginBackoff rolls back a sign-in attempt that must wait.
+	errLoginBackoff = errors.New("sign-in attempt must wait")
 )
 
 type (
@@ -50,6 +93,8 @@ func (r UserRepo) Add(firstName, lastName, userName, avatar string) (_ uint64, e
 	return uint64(userID), nil
 }
 
+// CertificateAdd registers a certificate to a user.  Its key isn't recorded
+// until its owner turns on renewal by key; see CertificateRenewByKey.
 func (r UserRepo) CertificateAdd(sha256 string, expireAt int64, userID uint64) error {
 	var db Inserter
 
@@ -70,12 +115,97 @@ func (r UserRepo) CertificateAdd(sha256 string, expireAt int64, userID uint64) e
 	return err
 }
 
+// CertificateBindKey records the public key hash of a certificate whose owner
+// has turned on renewal by key, so that CertificateRebind can find it.  It
+// leaves the certificate as it is if renewal by key is off, or if another
+// certificate already has the key.
+func (r UserRepo) CertificateBindKey(certSHA256, keySHA256 string) error {
+	bound := r.db.
+		From("certificates").
+		Select(L("1")).
+		Where(Ex{"key_sha256": keySHA256})
+
+	query := r.db.
+		Update("certificates").
+		Where(
+			Ex{"cert_sha256": certSHA256, "key_sha256": "", "renew_by_key": true},
+			L("NOT EXISTS ?", bound),
+		).
+		Set(
+			Record{"key_sha256": keySHA256},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// CertificateDelete revokes one of a user's certificates.  It returns
+// ErrLastCertificate rather than leave the user with no way to sign in.
+func (r UserRepo) CertificateDelete(userID uint64, certSHA256 string) error {
+	return r.inTx(func(tx UserRepo) error {
+		var count int
+
+		certificates := tx.tx.
+			From("certificates").
+			Select(COUNT("*")).
+			Where(Ex{"user_id": userID})
+
+		if _, err := certificates.ScanVal(&count); err != nil {
+			return err
+		}
+
+		if count < 2 {
+			return ErrLastCertificate
+		}
+
+		query := tx.tx.
+			Delete("certificates").
+			Where(Ex{"cert_sha256": certSHA256, "user_id": userID})
+
+		_, err := query.Executor().Exec()
+
+		return err
+	})
+}
+
+func (r UserRepo) CertificateGet(userID uint64, certSHA256 string) (_ model.Certificate, found bool, err error) {
+	var c model.Certificate
+
+	query := r.db.
+		From("certificates").
+		Where(Ex{"cert_sha256": certSHA256, "user_id": userID})
+
+	if found, err = query.ScanStruct(&c); err != nil || !found {
+		return
+	}
+
+	return c, true, nil
+}
+
+// CertificateLabel names one of a user's certificates, such as for the device
+// it's on.
+func (r UserRepo) CertificateLabel(userID uint64, certSHA256, label string) error {
+	query := r.db.
+		Update("certificates").
+		Where(Ex{"cert_sha256": certSHA256, "user_id": userID}).
+		Set(
+			Record{"label": label, "updated_at": r.now()},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// CertificateListByUser returns a user's certificates, oldest first.
 func (r UserRepo) CertificateListByUser(userID uint64) (_ []model.Certificate, err error) {
 	certificates := make([]model.Certificate, 0)
 
 	query := r.db.
 		From("certificates").
-		Where(Ex{"user_id": userID})
+		Where(Ex{"user_id": userID}).
+		Order(I("created_at").Asc(), I("rowid").Asc())
 
 	err = query.ScanStructs(&certificates)
 	if err != nil {
@@ -85,6 +215,76 @@ func (r UserRepo) CertificateListByUser(userID uint64) (_ []model.Certificate, e
 	return certificates, nil
 }
 
+// CertificateRebind moves the registration of the certificate with the given
+// public key hash over to a new certificate with the same key, such as when a
+// client renews its certificate.  The label and the rest are kept.  found is
+// false if no certificate with renewal by key turned on has the key.
+func (r UserRepo) CertificateRebind(keySHA256, certSHA256 string, expireAt int64) (found bool, err error) {
+	query := r.db.
+		Update("certificates").
+		Where(Ex{"key_sha256": keySHA256, "renew_by_key": true}).
+		Set(
+			Record{"cert_sha256": certSHA256, "expire_at": expireAt, "updated_at": r.now()},
+		)
+
+	result, err := query.Executor().Exec()
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	return affected > 0, nil
+}
+
+// CertificateRegistered reports whether a certificate is already registered
+// to an account, either itself or another certificate with the same public
+// key.
+func (r UserRepo) CertificateRegistered(certSHA256, keySHA256 string) (registered bool, err error) {
+	var count int
+
+	query := r.db.
+		From("certificates").
+		Select(COUNT("*")).
+		Where(
+			Or(
+				Ex{"cert_sha256": certSHA256},
+				And(Ex{"key_sha256": keySHA256}, C("key_sha256").Neq("")),
+			),
+		)
+
+	if _, err = query.ScanVal(&count); err != nil {
+		return
+	}
+
+	return count > 0, nil
+}
+
+// CertificateRenewByKey turns renewal by key on or off for one of a user's
+// certificates.  When it's on, a new certificate with the same public key
+// takes the certificate's place, as when a client renews it.  The key is
+// recorded the next time the certificate signs in, and forgotten when renewal
+// is turned off.
+func (r UserRepo) CertificateRenewByKey(userID uint64, certSHA256 string, renew bool) error {
+	record := Record{"renew_by_key": renew, "updated_at": r.now()}
+
+	if !renew {
+		record["key_sha256"] = ""
+	}
+
+	query := r.db.
+		Update("certificates").
+		Where(Ex{"cert_sha256": certSHA256, "user_id": userID}).
+		Set(record)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
 func (r UserRepo) CodeGet(_ uint64) (_ string, found bool, err error) {
 	var code string
 
@@ -108,6 +308,97 @@ func (r UserRepo) Commit() (_ error) {
 	return
 }
 
+// Follow records that the follower follows the followed user and notifies
+// the followed user.  Following someone again does nothing.
+func (r UserRepo) Follow(followerID, followedID uint64) error {
+	if followerID == followedID {
+		return ErrSelfFollow
+	}
+
+	return r.inTx(func(tx UserRepo) error {
+		query := tx.tx.
+			Insert("follows").
+			Rows(
+				Record{"followed_id": followedID, "follower_id": followerID},
+			).
+			OnConflict(DoNothing())
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+
+		return notify(tx.tx, followedID, followerID, model.NotificationFollow, 0)
+	})
+}
+
+func (r UserRepo) FollowCounts(userID uint64) (followers, following int, err error) {
+	query := r.db.
+		From("follows").
+		Select(
+			SUM(Case().When(Ex{"followed_id": userID}, 1).Else(0)).As("followers"),
+			SUM(Case().When(Ex{"follower_id": userID}, 1).Else(0)).As("following"),
+		).
+		Where(
+			Or(
+				Ex{"followed_id": userID},
+				Ex{"follower_id": userID},
+			),
+		)
+
+	counts := struct {
+		Followers sql.NullInt64 `db:"followers"`
+		Following sql.NullInt64 `db:"following"`
+	}{}
+
+	if _, err = query.ScanStruct(&counts); err != nil {
+		return
+	}
+
+	return int(counts.Followers.Int64), int(counts.Following.Int64), nil
+}
+
+func (r UserRepo) FollowerList(userID uint64) (_ []model.User, err error) {
+	users := make([]model.User, 0)
+
+	query := r.db.
+		From("users").
+		Join(
+			T("follows"), On(Ex{"users.id": I("follows.follower_id")}),
+		).
+		Where(Ex{"follows.followed_id": userID}).
+		Order(I("follows.created_at").Desc())
+
+	if err = query.ScanStructs(&users); err != nil {
+		return
+	}
+
+	return users, nil
+}
+
+func (r UserRepo) FollowingList(userID uint64) (_ []model.User, err error) {
+	users := make([]model.User, 0)
+
+	query := r.db.
+		From("users").
+		Join(
+			T("follows"), On(Ex{"users.id": I("follows.followed_id")}),
+		).
+		Where(Ex{"follows.follower_id": userID}).
+		Order(I("follows.created_at").Desc())
+
+	if err = query.ScanStructs(&users); err != nil {
+		return
+	}
+
+	return users, nil
+}
+
 func (r UserRepo) Get(id uint64) (_ model.User, found bool, err error) {
 	var u model.User
 
@@ -126,6 +417,9 @@ func (r UserRepo) Get(id uint64) (_ model.User, found bool, err error) {
 	return u, true, nil
 }
 
+// GetByCertificate returns the user a certificate belongs to.  It returns
+// ErrCertificateExpired or ErrAccountExpired once the certificate or the
+// account is past its expiry.  An expiry of 0 means never.
 func (r UserRepo) GetByCertificate(certSHA256 string) (_ model.User, found bool, err error) {
 	query := r.db.
 		From("users").
@@ -136,13 +430,26 @@ func (r UserRepo) GetByCertificate(certSHA256 string) (_ model.User, found bool,
 			Ex{"cert_sha256": certSHA256},
 		)
 
-	var u model.User
+	var u struct {
+		model.User
+		CertificateExpireAt int64 `db:"certificates.expire_at"`
+	}
 
 	if found, err = query.ScanStruct(&u); err != nil || !found {
 		return
 	}
 
-	return u, true, nil
+	now := r.now()
+
+	if u.CertificateExpireAt != 0 && u.CertificateExpireAt <= now {
+		return model.User{}, false, ErrCertificateExpired
+	}
+
+	if u.ExpireAt != 0 && u.ExpireAt <= now {
+		return model.User{}, false, ErrAccountExpired
+	}
+
+	return u.User, true, nil
 }
 
 func (r UserRepo) GetByUserName(userName string) (_ model.User, found bool, err error) {
@@ -161,6 +468,206 @@ func (r UserRepo) GetByUserName(userName string) (_ model.User, found bool, err
 	return u, true, nil
 }
 
+// GetByUserNameSkeleton returns the user whose username has the given
+// skeleton.  Skeletons are unique, so at most one user has it.
+func (r UserRepo) GetByUserNameSkeleton(skeleton string) (_ model.User, found bool, err error) {
+	var u model.User
+
+	if skeleton == "" {
+		return
+	}
+
+	query := r.db.
+		From("users").
+		Where(
+			Ex{"user_name_skeleton": skeleton},
+		)
+
+	if found, err = query.ScanStruct(&u); err != nil || !found {
+		return
+	}
+
+	return u, true, nil
+}
+
+func (r UserRepo) IsFollowing(followerID, followedID uint64) (_ bool, err error) {
+	var count int
+
+	query := r.db.
+		From("follows").
+		Select(COUNT("*")).
+		Where(Ex{"followed_id": followedID, "follower_id": followerID})
+
+	if _, err = query.ScanVal(&count); err != nil {
+		return
+	}
+
+	return count > 0, nil
+}
+
+// List returns every member, by username.  Users who haven't finished
+// registering, and so have no avatar yet, are left out.
+func (r UserRepo) List() (_ []model.User, err error) {
+	users := make([]model.User, 0)
+
+	query := r.db.
+		From("users").
+		Where(C("avatar").Neq("")).
+		Order(I("users.user_name").Asc())
+
+	if err = query.ScanStructs(&users); err != nil {
+		return
+	}
+
+	return users, nil
+}
+
+// LoginAttemptAdd records an attempt to sign in with a password before the
+// password is checked, so that attempts made at the same time can't all get
+// past the backoff.  The attempt counts as failed unless it's deleted with
+// LoginAttemptDelete once the password checks out.  If the client must wait
+// instead, as with LoginBackoff, nothing is recorded and wait is how many
+// seconds.  userID is 0 if no account has the username tried.
+func (r UserRepo) LoginAttemptAdd(certSHA256 string, userID uint64, userNameSkeleton string) (attemptID uint64, wait int64, err error) {
+	err = r.inTx(func(tx UserRepo) error {
+		query := tx.tx.
+			Insert("login_failures").
+			Rows(
+				Record{"cert_sha256": certSHA256, "created_at": tx.now(), "user_id": userID, "user_name_skeleton": userNameSkeleton},
+			)
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		attemptID = uint64(id)
+
+		wait, err = tx.loginBackoff(certSHA256, userNameSkeleton, attemptID)
+		if err != nil {
+			return err
+		}
+
+		if wait > 0 {
+			return errLoginBackoff
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errLoginBackoff) {
+		return 0, wait, nil
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return attemptID, 0, nil
+}
+
+// LoginAttemptDelete forgets an attempt recorded by LoginAttemptAdd whose
+// password was right, so that it doesn't count as a failure.
+func (r UserRepo) LoginAttemptDelete(attemptID uint64) error {
+	query := r.db.
+		Delete("login_failures").
+		Where(Ex{"id": attemptID})
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// LoginBackoff returns how many seconds a client must wait before trying a
+// password again, or 0 if it needn't.  Failed attempts count against both the
+// client's certificate and the username tried, identified by its skeleton, so
+// that neither guessing many passwords for one account nor spreading guesses
+// across client certificates gets far.  Usernames that don't exist back off
+// the same as those that do.
+func (r UserRepo) LoginBackoff(certSHA256, userNameSkeleton string) (wait int64, err error) {
+	return r.loginBackoff(certSHA256, userNameSkeleton, 0)
+}
+
+// LoginFailureList returns the most recent failed attempts to sign in to a
+// user's account, newest first.
+func (r UserRepo) LoginFailureList(userID uint64, limit uint) (_ []model.LoginFailure, err error) {
+	failures := make([]model.LoginFailure, 0)
+
+	query := r.db.
+		From("login_failures").
+		Where(Ex{"user_id": userID}).
+		Order(I("created_at").Desc(), I("id").Desc()).
+		Limit(limit)
+
+	if err = query.ScanStructs(&failures); err != nil {
+		return
+	}
+
+	return failures, nil
+}
+
+// PairingCodeAdd stores the hash of a new pairing code for a user, good for
+// lifetime.  The user's earlier codes, and any that have expired, are removed.
+func (r UserRepo) PairingCodeAdd(userID uint64, codeSHA256 string, lifetime time.Duration) error {
+	return r.inTx(func(tx UserRepo) error {
+		now := tx.now()
+
+		stale := tx.tx.
+			Delete("pairing_codes").
+			Where(
+				Or(
+					Ex{"user_id": userID},
+					C("expire_at").Lte(now),
+				),
+			)
+
+		if _, err := stale.Executor().Exec(); err != nil {
+			return err
+		}
+
+		query := tx.tx.
+			Insert("pairing_codes").
+			Rows(
+				Record{"code_sha256": codeSHA256, "expire_at": now + int64(lifetime.Seconds()), "user_id": userID},
+			)
+
+		_, err := query.Executor().Exec()
+
+		return err
+	})
+}
+
+// PairingCodeUse returns the user a pairing code belongs to and removes the
+// code, so it can't be used again.  found is false if the code is unknown or
+// has expired.
+func (r UserRepo) PairingCodeUse(codeSHA256 string) (userID uint64, found bool, err error) {
+	err = r.inTx(func(tx UserRepo) error {
+		query := tx.tx.
+			From("pairing_codes").
+			Select("user_id").
+			Where(Ex{"code_sha256": codeSHA256}, C("expire_at").Gt(tx.now()))
+
+		if found, err = query.ScanVal(&userID); err != nil || !found {
+			return err
+		}
+
+		used := tx.tx.
+			Delete("pairing_codes").
+			Where(Ex{"code_sha256": codeSHA256})
+
+		_, err = used.Executor().Exec()
+
+		return err
+	})
+
+	return
+}
+
 func (r UserRepo) PasswordGet(userID uint64) (_ model.Password, found bool, err error) {
 	var p model.Password
 
@@ -210,6 +717,65 @@ func (r UserRepo) PasswordSet(userID uint64, password model.Password) error {
 	return nil
 }
 
+func (r UserRepo) ProfileFieldDelete(userID uint64, name string) error {
+	query := r.db.
+		Delete("profile_fields").
+		Where(Ex{"name": name, "user_id": userID})
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
+// ProfileFieldList returns a user's custom profile fields in the order they
+// were added.
+func (r UserRepo) ProfileFieldList(userID uint64) (_ []model.ProfileField, err error) {
+	fields := make([]model.ProfileField, 0, maxProfileFields)
+
+	query := r.db.
+		From("profile_fields").
+		Where(Ex{"user_id": userID}).
+		Order(I("id").Asc())
+
+	if err = query.ScanStructs(&fields); err != nil {
+		return
+	}
+
+	return fields, nil
+}
+
+// ProfileFieldSet sets the value of a custom profile field, adding the field
+// if the user has room for another.
+func (r UserRepo) ProfileFieldSet(userID uint64, name, value string) error {
+	return r.inTx(func(tx UserRepo) error {
+		var others int
+
+		count := tx.tx.
+			From("profile_fields").
+			Select(COUNT("*")).
+			Where(Ex{"user_id": userID}, C("name").Neq(name))
+
+		if _, err := count.ScanVal(&others); err != nil {
+			return err
+		}
+
+		if others >= maxProfileFields {
+			return ErrProfileFieldLimit
+		}
+
+		query := tx.tx.
+			Insert("profile_fields").
+			Rows(
+				Record{"name": name, "user_id": userID, "value": value},
+			).
+			OnConflict(DoUpdate("user_id, name", Record{"value": value, "updated_at": tx.now()}))
+
+		_, err := query.Executor().Exec()
+
+		return err
+	})
+}
+
 func (r UserRepo) ProfileGet(userID uint64) (_ model.Profile, _ []model.Certificate, found bool, err error) {
 	var profile model.Profile
 
@@ -253,6 +819,56 @@ func (r UserRepo) Begin() (_ UserRepo, err error) {
 	}, nil
 }
 
+// Search returns the members whose username, first name or last name contains
+// each word of text, by username.  As with List, users who haven't finished
+// registering are left out.  Case is folded in Go rather than by SQLite,
+// whose lower() only knows ASCII, so that "łukasz" finds Łukasz.
+func (r UserRepo) Search(text string) (_ []model.User, err error) {
+	users := make([]model.User, 0)
+
+	fold := cases.Fold()
+
+	words := strings.Fields(fold.String(norm.NFC.String(text)))
+	if len(words) == 0 {
+		return users, nil
+	}
+
+	members := make([]model.User, 0)
+
+	query := r.db.
+		From("users").
+		Where(C("avatar").Neq("")).
+		Order(I("users.user_name").Asc())
+
+	if err = query.ScanStructs(&members); err != nil {
+		return
+	}
+
+	for _, u := range members {
+		names := fold.String(strings.Join([]string{u.UserName, u.FirstName, u.LastName}, "\n"))
+
+		if containsAll(names, words) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (r UserRepo) Unfollow(followerID, followedID uint64) error {
+	return r.inTx(func(tx UserRepo) error {
+		query := tx.tx.
+			Delete("follows").
+			Where(Ex{"followed_id": followedID, "follower_id": followerID})
+
+		if _, err := query.Executor().Exec(); err != nil {
+			return err
+		}
+
+		return unnotify(tx.tx, followedID, followerID, model.NotificationFollow, 0)
+	})
+}
+
 func (r UserRepo) UpdateAvatar(userID uint64, avatar string) error {
 	query := r.db.
 		Update("users").
@@ -278,6 +894,45 @@ func (r UserRepo) UpdateAvatar(userID uint64, avatar string) error {
 	return nil
 }
 
+func (r UserRepo) UpdateBio(userID uint64, bio string) error {
+	query := r.db.
+		Update("users").
+		Where(Ex{"id": userID}).
+		Set(
+			Record{"bio": bio, "updated_at": r.now()},
+		)
+
+	result, err := query.Executor().Exec()
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
+
+// UpdateCertificateSeen records when a certificate was last used to sign in.
+func (r UserRepo) UpdateCertificateSeen(certSHA256 string) error {
+	query := r.db.
+		Update("certificates").
+		Where(Ex{"cert_sha256": certSHA256}).
+		Set(
+			Record{"last_used_at": r.now()},
+		)
+
+	_, err := query.Executor().Exec()
+
+	return err
+}
+
 func (r UserRepo) UpdateFirstName(userID uint64, firstName string) error {
 	query := r.db.
 		Update("users").
@@ -328,12 +983,12 @@ func (r UserRepo) UpdateLastName(userID uint64, lastName string) error {
 	return nil
 }
 
-func (r UserRepo) UpdateSeen(userID uint64) error {
+func (r UserRepo) UpdatePronouns(userID uint64, pronouns string) error {
 	query := r.db.
 		Update("users").
 		Where(Ex{"id": userID}).
 		Set(
-			Record{"last_seen": r.now()},
+			Record{"pronouns": pronouns, "updated_at": r.now()},
 		)
 
 	result, err := query.Executor().Exec()
@@ -353,12 +1008,12 @@ func (r UserRepo) UpdateSeen(userID uint64) error {
 	return nil
 }
 
-func (r UserRepo) UpdateUserName(userID uint64, userName string) error {
+func (r UserRepo) UpdateSeen(userID uint64) error {
 	query := r.db.
 		Update("users").
 		Where(Ex{"id": userID}).
 		Set(
-			Record{"user_name": userName, "updated_at": r.now()},
+			Record{"last_seen": r.now()},
 		)
 
 	result, err := query.Executor().Exec()
@@ -378,6 +1033,104 @@ func (r UserRepo) UpdateUserName(userID uint64, userName string) error {
 	return nil
 }
 
+// UpdateUserName sets a user's username along with its skeleton, the form used
+// to catch lookalike usernames.  It returns ErrUserNameTaken if another user has
+// the same username or skeleton.
+func (r UserRepo) UpdateUserName(userID uint64, userName, skeleton string) error {
+	return r.inTx(func(tx UserRepo) error {
+		var others int
+
+		count := tx.tx.
+			From("users").
+			Select(COUNT("*")).
+			Where(
+				C("id").Neq(userID),
+				Or(
+					Ex{"user_name": userName},
+					Ex{"user_name_skeleton": skeleton},
+				),
+			)
+
+		if _, err := count.ScanVal(&others); err != nil {
+			return err
+		}
+
+		if others > 0 {
+			return ErrUserNameTaken
+		}
+
+		query := tx.tx.
+			Update("users").
+			Where(Ex{"id": userID}).
+			Set(
+				Record{"user_name": userName, "user_name_skeleton": skeleton, "updated_at": tx.now()},
+			)
+
+		result, err := query.Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return errors.New("no rows affected")
+		}
+
+		return nil
+	})
+}
+
+// UserNameSkeletonBackfill records the skeletons of usernames chosen before
+// skeletons were kept.  A username whose skeleton already belongs to another
+// user is left without one.
+func (r UserRepo) UserNameSkeletonBackfill(skeleton func(string) string) error {
+	return r.inTx(func(tx UserRepo) error {
+		users := make([]model.User, 0)
+
+		query := tx.tx.
+			From("users").
+			Where(Ex{"user_name_skeleton": ""})
+
+		if err := query.ScanStructs(&users); err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			var others int
+
+			s := skeleton(u.UserName)
+
+			count := tx.tx.
+				From("users").
+				Select(COUNT("*")).
+				Where(Ex{"user_name_skeleton": s})
+
+			if _, err := count.ScanVal(&others); err != nil {
+				return err
+			}
+
+			if others > 0 {
+				continue
+			}
+
+			update := tx.tx.
+				Update("users").
+				Where(Ex{"id": u.ID}).
+				Set(Record{"user_name_skeleton": s})
+
+			if _, err := update.Executor().Exec(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 // WithTx starts a new transaction and executes it in Wrap method
 func (r UserRepo) WithTx(fn func(UserRepo) error) error {
 	tx, err := r.db.Begin()
@@ -397,3 +1150,63 @@ func (r UserRepo) WithTx(fn func(UserRepo) error) error {
 		},
 	)
 }
+
+// inTx runs fn in the current transaction, or in a new one if there is none.
+func (r UserRepo) inTx(fn func(UserRepo) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	return r.WithTx(fn)
+}
+
+// loginBackoff is LoginBackoff, leaving out the attempt with exceptID.
+func (r UserRepo) loginBackoff(certSHA256, userNameSkeleton string, exceptID uint64) (wait int64, err error) {
+	db := ifThenElse[Fromer](r.tx != nil, r.tx, r.db)
+
+	now := r.now()
+
+	for _, where := range []Ex{{"cert_sha256": certSHA256}, {"user_name_skeleton": userNameSkeleton}} {
+		var failures struct {
+			Count int   `db:"count"`
+			Last  int64 `db:"last"`
+		}
+
+		query := db.
+			From("login_failures").
+			Select(
+				COUNT("*").As("count"),
+				COALESCE(MAX("created_at"), 0).As("last"),
+			).
+			Where(where, C("created_at").Gt(now-loginFailureWindow), C("id").Neq(exceptID))
+
+		if _, err = query.ScanStruct(&failures); err != nil {
+			return
+		}
+
+		if failures.Count < loginFreeFailures {
+			continue
+		}
+
+		backoff := int64(loginBackoffMax)
+
+		if doublings := failures.Count - loginFreeFailures; doublings < 7 {
+			backoff = min(int64(loginBackoff)<<doublings, loginBackoffMax)
+		}
+
+		wait = max(wait, failures.Last+backoff-now)
+	}
+
+	return wait, nil
+}
+
+// containsAll reports whether s contains each of words.
+func containsAll(s string, words []string) bool {
+	for _, word := range words {
+		if !strings.Contains(s, word) {
+			return false
+		}
+	}
+
+	return true
+}